@@ -2,12 +2,13 @@ package main
 
 import (
 	"context"
-	"github.com/peetermeos/tabot/internal/app/prebot"
-	"github.com/peetermeos/tabot/internal/pkg/kraken"
 	"os"
 
 	_ "github.com/breml/rootcerts"
 	"github.com/peetermeos/tabot/config"
+	"github.com/peetermeos/tabot/internal/app/prebot"
+	"github.com/peetermeos/tabot/internal/pkg/fees"
+	"github.com/peetermeos/tabot/internal/pkg/kraken"
 	"github.com/sirupsen/logrus"
 )
 
@@ -27,13 +28,31 @@ func main() {
 
 	krakenClient := kraken.NewClient(ctx, logger, cfg.KrakenKey, cfg.KrakenSecret)
 
+	err = krakenClient.SubscribeInstruments(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("error subscribing to instruments")
+	}
+
+	feeModel := fees.NewModel(fees.KrakenTiers, cfg.FeeVolume)
+
+	err = feeModel.Refresh(ctx, kraken.NewRESTClient(cfg.KrakenKey, cfg.KrakenSecret))
+	if err != nil {
+		logger.WithError(err).Warn("error fetching fee schedule, using configured volume")
+	}
+
 	botInput := prebot.BotInput{
 		Logger:     logger,
 		MarketData: krakenClient,
+		Fees:       feeModel,
 		Symbol:     cfg.Symbol,
 	}
 
 	app := prebot.NewPressureBot(botInput)
 
-	app.Run(ctx)
+	err = app.Run(ctx)
+	if err != nil {
+		logger.WithError(err).Error("error running bot")
+
+		os.Exit(1)
+	}
 }
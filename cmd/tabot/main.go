@@ -4,15 +4,21 @@ import (
 	"context"
 	"os"
 	"strings"
+	"time"
 
 	_ "github.com/breml/rootcerts"
 	"github.com/peetermeos/tabot/config"
 	"github.com/peetermeos/tabot/internal/app/tabot"
+	"github.com/peetermeos/tabot/internal/pkg/fees"
+	"github.com/peetermeos/tabot/internal/pkg/journal"
 	"github.com/peetermeos/tabot/internal/pkg/kraken"
 	"github.com/peetermeos/tabot/internal/pkg/mock"
 	"github.com/sirupsen/logrus"
 )
 
+// equityInterval is how often the paper portfolio is marked to market.
+const equityInterval = time.Minute
+
 func main() {
 	ctx := context.Background()
 	tabotLogger := logrus.WithField("origin", "tabot")
@@ -28,16 +34,98 @@ func main() {
 	logrus.SetLevel(logLevel)
 
 	krakenClient := kraken.NewClient(ctx, tabotLogger, cfg.KrakenKey, cfg.KrakenSecret)
-	mockPortfolio := mock.NewPortfolio(10000, "USD", 0.0025)
+
+	err = krakenClient.SubscribeInstruments(ctx)
+	if err != nil {
+		tabotLogger.WithError(err).Warn("error subscribing to instruments")
+	}
+
+	feeModel := fees.NewModel(fees.KrakenTiers, cfg.FeeVolume)
+
+	err = feeModel.Refresh(ctx, kraken.NewRESTClient(cfg.KrakenKey, cfg.KrakenSecret))
+	if err != nil {
+		tabotLogger.WithError(err).Warn("error fetching fee schedule, using configured volume")
+	}
+
+	// Paper trades fill against the books the bot subscribes to, which also
+	// mark the portfolio to market
+	portfolio := mock.NewPortfolio(10000, cfg.Reporting, feeModel, krakenClient)
+
+	var execution tabot.ExecutionProvider = mock.NewPaperTrader(portfolio, krakenClient, feeModel, cfg.PaperLatency)
+	if cfg.LiveTrading {
+		trader := kraken.NewTrader(ctx, tabotLogger, cfg.KrakenKey, cfg.KrakenSecret, cfg.Reporting)
+
+		err = trader.SubscribeInstruments(ctx)
+		if err == nil {
+			err = trader.SubscribeBalances(ctx)
+		}
+
+		if err == nil {
+			err = trader.SubscribeExecutions(ctx)
+		}
+
+		if err != nil {
+			tabotLogger.WithError(err).Error("error subscribing to account updates")
+
+			os.Exit(1)
+		}
+
+		execution = trader
+	} else {
+		go portfolio.Track(ctx, equityInterval)
+	}
+
+	// Without a path, opportunities are only logged
+	var opportunityJournal tabot.Journal
+
+	if cfg.Journal != "" {
+		journalFile, err := journal.NewFile(cfg.Journal)
+		if err != nil {
+			tabotLogger.WithError(err).Error("error opening journal")
+
+			os.Exit(1)
+		}
+
+		defer func() { _ = journalFile.Close() }()
+
+		opportunityJournal = journalFile
+	}
 
 	botInput := tabot.BotInput{
 		Logger:     tabotLogger,
 		MarketData: krakenClient,
-		Execution:  mockPortfolio,
+		Execution:  execution,
+		Fees:       feeModel,
 		Symbols:    strings.Split(cfg.Symbols, ","),
+		MaxLegs:    cfg.MaxLegs,
+		Evaluator: tabot.ProfitEvaluator{
+			MinEdgeBps: cfg.MinEdgeBps,
+			MinProfit:  cfg.MinProfit,
+		},
+		ExecutionMode: tabot.ExecutionMode(cfg.Execution),
+		Recovery: tabot.RecoveryPolicy{
+			MinValue:   cfg.RecoveryMinValue,
+			MaxCostBps: cfg.RecoveryMaxCostBps,
+		},
+		Journal: opportunityJournal,
+		Books:   krakenClient,
+
+		SlippageToleranceBps: cfg.SlippageToleranceBps,
+		LegTimeout:           cfg.LegTimeout,
+
+		MaxQuoteAge:  cfg.MaxQuoteAge,
+		MaxQuoteSkew: cfg.MaxQuoteSkew,
+
+		Anchors:           strings.Split(cfg.Anchors, ","),
+		ReportingCurrency: cfg.Reporting,
 	}
 
 	app := tabot.NewTriangleBot(botInput)
 
-	app.Run(ctx)
+	err = app.Run(ctx)
+	if err != nil {
+		tabotLogger.WithError(err).Error("error running bot")
+
+		os.Exit(1)
+	}
 }
@@ -3,25 +3,60 @@ package config
 import (
 	"os"
 	"reflect"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
 type Config struct {
-	LogLevel     string `env:"LOGLEVEL"`
-	AWSRegion    string `env:"AWS_REGION"`
-	KrakenKey    string `env:"KRAKEN_API_KEY"`
-	KrakenSecret string `env:"KRAKEN_API_SECRET"`
-	Symbols      string `env:"SYMBOLS"`
-	Symbol       string `env:"SYMBOL"`
+	LogLevel     string  `env:"LOGLEVEL"`
+	AWSRegion    string  `env:"AWS_REGION"`
+	KrakenKey    string  `env:"KRAKEN_API_KEY"`
+	KrakenSecret string  `env:"KRAKEN_API_SECRET"`
+	Symbols      string  `env:"SYMBOLS"`
+	Symbol       string  `env:"SYMBOL"`
+	LiveTrading  bool    `env:"LIVE_TRADING"`
+	FeeVolume    float64 `env:"FEE_VOLUME"`
+	MaxLegs      int     `env:"MAX_LEGS"`
+	Anchors      string  `env:"ANCHORS"`
+	Reporting    string  `env:"REPORTING_CURRENCY"`
+	MinEdgeBps   float64 `env:"MIN_EDGE_BPS"`
+	MinProfit    float64 `env:"MIN_PROFIT"`
+	Execution    string  `env:"EXECUTION_MODE"`
+	Journal      string  `env:"JOURNAL_PATH"`
+
+	RecoveryMinValue   float64 `env:"RECOVERY_MIN_VALUE"`
+	RecoveryMaxCostBps float64 `env:"RECOVERY_MAX_COST_BPS"`
+
+	MaxQuoteAge  time.Duration `env:"MAX_QUOTE_AGE"`
+	MaxQuoteSkew time.Duration `env:"MAX_QUOTE_SKEW"`
+	PaperLatency time.Duration `env:"PAPER_LATENCY"`
+
+	SlippageToleranceBps float64       `env:"SLIPPAGE_TOLERANCE_BPS"`
+	LegTimeout           time.Duration `env:"LEG_TIMEOUT"`
 }
 
-var ErrFieldNotDefined = errors.New("environment variable name tag for field is not defined")
+var (
+	ErrFieldNotDefined = errors.New("environment variable name tag for field is not defined")
+	ErrInvalidValue    = errors.New("invalid environment variable value")
+)
 
 func Load() (*Config, error) {
 	config := Config{
 		LogLevel:  "debug",
 		AWSRegion: "us-east-1",
+		Anchors:   "USD",
+		Reporting: "USD",
+		Journal:   "journal/opportunities.jsonl",
+
+		MaxQuoteAge:  time.Minute,
+		MaxQuoteSkew: 30 * time.Second,
+
+		RecoveryMinValue:   10,
+		RecoveryMaxCostBps: 100,
+
+		LegTimeout: 30 * time.Second,
 	}
 
 	typeOf := reflect.TypeOf(config)
@@ -46,7 +81,39 @@ func Load() (*Config, error) {
 			}
 
 			if field.Type.Kind() == reflect.Bool {
-				valueOf.FieldByName(field.Name).SetBool(true)
+				parsed, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, errors.Wrapf(ErrInvalidValue, "%s: %s", tag, value)
+				}
+
+				valueOf.FieldByName(field.Name).SetBool(parsed)
+			}
+
+			if field.Type.Kind() == reflect.Float64 {
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return nil, errors.Wrapf(ErrInvalidValue, "%s: %s", tag, value)
+				}
+
+				valueOf.FieldByName(field.Name).SetFloat(parsed)
+			}
+
+			if field.Type == reflect.TypeOf(time.Duration(0)) {
+				parsed, err := time.ParseDuration(value)
+				if err != nil {
+					return nil, errors.Wrapf(ErrInvalidValue, "%s: %s", tag, value)
+				}
+
+				valueOf.FieldByName(field.Name).SetInt(int64(parsed))
+			}
+
+			if field.Type.Kind() == reflect.Int {
+				parsed, err := strconv.Atoi(value)
+				if err != nil {
+					return nil, errors.Wrapf(ErrInvalidValue, "%s: %s", tag, value)
+				}
+
+				valueOf.FieldByName(field.Name).SetInt(int64(parsed))
 			}
 		}
 	}
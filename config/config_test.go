@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestLoad_bool(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    bool
+		wantErr error
+	}{
+		{"True", "true", true, nil},
+		{"One", "1", true, nil},
+		{"False", "false", false, nil},
+		{"Zero", "0", false, nil},
+		{"Invalid", "yes please", false, ErrInvalidValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LIVE_TRADING", tt.value)
+
+			got, err := Load()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got.LiveTrading != tt.want {
+				t.Errorf("Load() LiveTrading = %v, want %v", got.LiveTrading, tt.want)
+			}
+		})
+	}
+}
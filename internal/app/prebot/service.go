@@ -3,19 +3,19 @@ package prebot
 import (
 	"context"
 	"fmt"
+
+	"github.com/peetermeos/tabot/internal/pkg/fees"
+	"github.com/peetermeos/tabot/internal/pkg/orderbook"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"math"
-	"sort"
 )
 
 const bookLength = 10
 
-const fee = 0.0025
-
 type MarketDataProvider interface {
 	StreamBook(ctx context.Context) <-chan Book
-	SubscribeBook(symbol string) error
-	UnsubscribeBook(symbol string) error
+	SubscribeBook(ctx context.Context, symbol string) error
+	UnsubscribeBook(ctx context.Context, symbol string) error
 }
 
 type ExecutionProvider interface {
@@ -47,103 +47,82 @@ type ExecutionInput struct {
 type PressureBot struct {
 	logger logrus.FieldLogger
 	data   MarketDataProvider
+	fees   *fees.Model
 	symbol string
 
-	askBook []bookItem
-	bidBook []bookItem
+	book *orderbook.Book
 
 	position float64
 	price    float64
 }
 
-type bookItem struct {
-	price  float64
-	volume float64
-}
-
 type BotInput struct {
 	Logger     logrus.FieldLogger
 	MarketData MarketDataProvider
+	Fees       *fees.Model
 	Symbol     string
 }
 
+// NewPressureBot creates the bot for the symbol. Without a fee model, fees
+// come from the lowest tier of the Kraken schedule.
 func NewPressureBot(input BotInput) *PressureBot {
+	feeModel := input.Fees
+	if feeModel == nil {
+		feeModel = fees.NewModel(fees.KrakenTiers, 0)
+	}
+
 	return &PressureBot{
-		logger:  input.Logger.WithField("comp", "prebot"),
-		data:    input.MarketData,
-		symbol:  input.Symbol,
-		askBook: make([]bookItem, 0),
-		bidBook: make([]bookItem, 0),
+		logger: input.Logger.WithField("comp", "prebot"),
+		data:   input.MarketData,
+		fees:   feeModel,
+		symbol: input.Symbol,
+		book:   orderbook.New(input.Symbol, bookLength),
 	}
 }
 
-func (b *PressureBot) Run(ctx context.Context) {
-	err := b.data.SubscribeBook(b.symbol)
-	if err != nil {
-		b.logger.WithError(err).Error("error subscribing to book")
+func (b *PressureBot) Run(ctx context.Context) error {
+	// The snapshot is only delivered to streams that exist when it arrives
+	stream := b.data.StreamBook(ctx)
 
-		return
+	err := b.data.SubscribeBook(ctx, b.symbol)
+	if err != nil {
+		return errors.Wrap(err, "error subscribing to book")
 	}
 
-	stream := b.data.StreamBook(ctx)
-
 	pnl := 0.0
 
 	for {
 		select {
-		case book := <-stream:
-			b.logger.WithField("book", fmt.Sprintf("%+v", book)).Debug("received book")
-
-			if !book.IsUpdate {
-				b.askBook = make([]bookItem, 0)
-				b.bidBook = make([]bookItem, 0)
-			}
-
-			for _, bid := range book.Bids {
-				if bid.Volume == 0 {
-					b.bidBook = removeLevel(b.bidBook, bid.Price)
-
-					continue
-				}
+		case book, ok := <-stream:
+			if !ok {
+				b.logger.Info("market data stream closed")
 
-				b.bidBook = setVolume(b.bidBook, bid.Price, bid.Volume)
+				return nil
 			}
 
-			for _, ask := range book.Asks {
-				if ask.Volume == 0 {
-					b.askBook = removeLevel(b.askBook, ask.Price)
-
-					continue
-				}
-
-				b.askBook = setVolume(b.askBook, ask.Price, ask.Volume)
-			}
+			b.logger.WithField("book", fmt.Sprintf("%+v", book)).Debug("received book")
 
-			if len(b.askBook) > bookLength {
-				// Clean up book, retain lowest 10 elements
-				b.askBook = b.askBook[:bookLength]
-			}
+			bids := toLevels(book.Bids)
+			asks := toLevels(book.Asks)
 
-			if len(b.bidBook) > bookLength {
-				// Clean up book, retain top 10 elements
-				b.bidBook = b.bidBook[(len(b.bidBook) - bookLength):]
+			if book.IsUpdate {
+				b.book.ApplyUpdate(bids, asks)
+			} else {
+				b.book.ApplySnapshot(bids, asks)
 			}
 
-			totalBid := 0.0
-			maxBid := 0.0
+			bestBid, okBid := b.book.BestBid()
+			bestAsk, okAsk := b.book.BestAsk()
 
-			for _, item := range b.bidBook {
-				totalBid += item.volume
-				maxBid = math.Max(maxBid, item.price)
+			if !okBid || !okAsk {
+				continue
 			}
 
-			totalAsk := 0.0
-			minAsk := 9999999999.0
+			totalBid := b.book.Depth(orderbook.Bid, bookLength)
+			maxBid := bestBid.Price
 
-			for _, item := range b.askBook {
-				totalAsk += item.volume
-				minAsk = math.Min(minAsk, item.price)
-			}
+			totalAsk := b.book.Depth(orderbook.Ask, bookLength)
+			minAsk := bestAsk.Price
 
 			const threshold = 30
 
@@ -154,7 +133,7 @@ func (b *PressureBot) Run(ctx context.Context) {
 					continue
 				}
 
-				pnl -= tradeSize * fee
+				pnl -= tradeSize * b.fees.Taker(b.symbol)
 
 				b.logger.WithFields(logrus.Fields{
 					"total_bid": fmt.Sprintf("%.4f", totalBid),
@@ -174,7 +153,7 @@ func (b *PressureBot) Run(ctx context.Context) {
 					continue
 				}
 
-				pnl -= tradeSize * fee
+				pnl -= tradeSize * b.fees.Taker(b.symbol)
 
 				b.logger.WithFields(logrus.Fields{
 					"total_bid": fmt.Sprintf("%.4f", totalBid),
@@ -193,7 +172,7 @@ func (b *PressureBot) Run(ctx context.Context) {
 
 			if maxBid >= b.price+target && b.position > 0 {
 				pnl += b.position * (maxBid - b.price)
-				pnl -= tradeSize * fee
+				pnl -= tradeSize * b.fees.Taker(b.symbol)
 
 				b.logger.
 					WithFields(logrus.Fields{
@@ -208,7 +187,7 @@ func (b *PressureBot) Run(ctx context.Context) {
 
 			if minAsk <= b.price-target && b.position < 0 {
 				pnl += b.position * (b.price - minAsk)
-				pnl -= tradeSize * fee
+				pnl -= tradeSize * b.fees.Taker(b.symbol)
 
 				b.logger.
 					WithFields(logrus.Fields{
@@ -223,7 +202,7 @@ func (b *PressureBot) Run(ctx context.Context) {
 
 			if minAsk < b.price && b.position > 0 {
 				pnl += b.position * (maxBid - b.price)
-				pnl -= tradeSize * fee
+				pnl -= tradeSize * b.fees.Taker(b.symbol)
 
 				b.logger.
 					WithFields(logrus.Fields{
@@ -238,7 +217,7 @@ func (b *PressureBot) Run(ctx context.Context) {
 
 			if maxBid > b.price && b.position < 0 {
 				pnl += b.position * (b.price - minAsk)
-				pnl -= tradeSize * fee
+				pnl -= tradeSize * b.fees.Taker(b.symbol)
 
 				b.logger.
 					WithFields(logrus.Fields{
@@ -254,41 +233,17 @@ func (b *PressureBot) Run(ctx context.Context) {
 		case <-ctx.Done():
 			b.logger.Info("closing down")
 
-			return
+			return nil
 		}
 	}
 }
 
-func setVolume(book []bookItem, price, volume float64) []bookItem {
-	for i, item := range book {
-		if item.price == price {
-			book[i].volume = volume
+func toLevels(levels []Level2Book) []orderbook.Level {
+	result := make([]orderbook.Level, 0, len(levels))
 
-			return book
-		}
-	}
-
-	book = append(book, bookItem{
-		price:  price,
-		volume: volume,
-	})
-
-	// sort the book by price
-	sort.Slice(book, func(i, j int) bool {
-		return book[i].price < book[j].price
-	})
-
-	return book
-}
-
-func removeLevel(book []bookItem, price float64) []bookItem {
-	for i, item := range book {
-		if item.price == price {
-			book = append(book[:i], book[i+1:]...)
-
-			break
-		}
+	for _, level := range levels {
+		result = append(result, orderbook.Level{Price: level.Price, Volume: level.Volume})
 	}
 
-	return book
+	return result
 }
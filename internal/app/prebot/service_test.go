@@ -0,0 +1,84 @@
+package prebot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/peetermeos/tabot/internal/pkg/fees"
+	"github.com/sirupsen/logrus"
+)
+
+// marketData streams the books once the bot subscribed, unless it opened
+// its stream too late to receive them.
+type marketData struct {
+	books    []Book
+	stream   chan Book
+	streamed bool
+}
+
+func (m *marketData) StreamBook(_ context.Context) <-chan Book {
+	m.streamed = true
+
+	return m.stream
+}
+
+func (m *marketData) SubscribeBook(_ context.Context, _ string) error {
+	books := m.books
+	if !m.streamed {
+		books = nil
+	}
+
+	go func() {
+		for _, book := range books {
+			m.stream <- book
+		}
+
+		close(m.stream)
+	}()
+
+	return nil
+}
+
+func (m *marketData) UnsubscribeBook(_ context.Context, _ string) error {
+	return nil
+}
+
+func TestPressureBot_Run(t *testing.T) {
+	tests := []struct {
+		name string
+		fees *fees.Model
+	}{
+		{"Given fees", fees.NewModel([]fees.Tier{{Rates: fees.Rates{Taker: 0.001}}}, 0)},
+		{"Default fees", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &marketData{
+				// Bid pressure well above the threshold enters a long
+				books: []Book{{
+					Symbol: "BTC/USD",
+					Bids:   []Level2Book{{Price: 99, Volume: 50}},
+					Asks:   []Level2Book{{Price: 100, Volume: 1}},
+				}},
+				stream: make(chan Book),
+			}
+
+			bot := NewPressureBot(BotInput{
+				Logger:     logrus.New(),
+				MarketData: data,
+				Fees:       tt.fees,
+				Symbol:     "BTC/USD",
+			})
+
+			err := bot.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			if bot.position == 0 {
+				t.Errorf("Run() did not trade the book, position = %v", bot.position)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package tabot
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// detector finds profitable cycles in the exchange rate graph. Rates are kept
+// as -log(rate) edge weights, so the weights of a cycle sum up to a negative
+// score exactly when trading around it returns more than it started with.
+//
+// Bellman-Ford finds a negative cycle without enumerating them, but only one
+// at a time, of unbounded length and not necessarily through the anchor, so it
+// cannot rank opportunities. Instead, all cycles up to the configured length
+// are enumerated upfront and a tick only rescores the cycles trading the
+// changed edge.
+type detector struct {
+	// mu guards the rates against snapshots taken off the tick loop, which
+	// is the only writer
+	mu sync.RWMutex
+
+	rates   *mat.Dense
+	weights *mat.Dense
+
+	// depths is the amount of the source currency the best rate takes
+	depths *mat.Dense
+
+	// updated is the time of the tick each rate was last set from
+	updated [][]time.Time
+
+	// maxAge and maxSkew limit how old the rates of a cycle may be and how
+	// far apart their ticks, zero for no limit
+	maxAge  time.Duration
+	maxSkew time.Duration
+
+	cycles []cycle
+	scores []float64
+
+	// byLeg lists the cycles trading each directed leg, by their index
+	byLeg map[[2]int][]int
+}
+
+func newDetector(dim int, cycles []cycle) *detector {
+	d := &detector{
+		rates:   mat.NewDense(dim, dim, nil),
+		weights: mat.NewDense(dim, dim, nil),
+		depths:  mat.NewDense(dim, dim, nil),
+		updated: make([][]time.Time, dim),
+		cycles:  cycles,
+		scores:  make([]float64, len(cycles)),
+		byLeg:   make(map[[2]int][]int),
+	}
+
+	// Initialize exchange matrix as identity matrix, missing rates have an
+	// infinite weight until their first tick
+	for i := 0; i < dim; i++ {
+		d.updated[i] = make([]time.Time, dim)
+
+		for j := 0; j < dim; j++ {
+			d.weights.Set(i, j, math.Inf(1))
+		}
+
+		d.rates.Set(i, i, 1)
+		d.weights.Set(i, i, 0)
+	}
+
+	for idx, c := range cycles {
+		d.scores[idx] = math.Inf(1)
+
+		for _, leg := range c.legs() {
+			d.byLeg[leg] = append(d.byLeg[leg], idx)
+		}
+	}
+
+	return d
+}
+
+// update sets the rate of converting from one currency to another and the
+// amount of the source currency available at that rate as of the given time,
+// rescores the cycles trading that leg and returns their indices.
+func (d *detector) update(from, to int, rate, depth float64, at time.Time) []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.rates.Set(from, to, rate)
+	d.depths.Set(from, to, depth)
+	d.updated[from][to] = at
+
+	if rate > 0 {
+		d.weights.Set(from, to, -math.Log(rate))
+	} else {
+		d.weights.Set(from, to, math.Inf(1))
+	}
+
+	affected := d.byLeg[[2]int{from, to}]
+
+	for _, idx := range affected {
+		score := 0.0
+
+		for _, leg := range d.cycles[idx].legs() {
+			score += d.weights.At(leg[0], leg[1])
+		}
+
+		d.scores[idx] = score
+	}
+
+	return affected
+}
+
+// snapshot returns a copy of the detector as of now, for use while the
+// original keeps being updated.
+func (d *detector) snapshot() *detector {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	updated := make([][]time.Time, len(d.updated))
+	for i, row := range d.updated {
+		updated[i] = append([]time.Time(nil), row...)
+	}
+
+	return &detector{
+		rates:   mat.DenseCopyOf(d.rates),
+		weights: mat.DenseCopyOf(d.weights),
+		depths:  mat.DenseCopyOf(d.depths),
+		updated: updated,
+		maxAge:  d.maxAge,
+		maxSkew: d.maxSkew,
+		cycles:  d.cycles,
+		scores:  append([]float64(nil), d.scores...),
+		byLeg:   d.byLeg,
+	}
+}
+
+// rate returns the gross return of trading around the cycle, 1 being break
+// even.
+func (d *detector) rate(idx int) float64 {
+	return math.Exp(-d.scores[idx])
+}
+
+// rank returns the profitable cycles among the given ones, the most
+// profitable first.
+func (d *detector) rank(indices []int) []int {
+	ranked := make([]int, 0, len(indices))
+
+	for _, idx := range indices {
+		if d.scores[idx] < 0 {
+			ranked = append(ranked, idx)
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool { return d.scores[ranked[i]] < d.scores[ranked[j]] })
+
+	return ranked
+}
+
+// stale reports whether any rate of the cycle is older than the max age at
+// the given time, or the rates were ticked further apart than the max skew.
+// A stale cycle may look profitable only because some of its rates moved on.
+func (d *detector) stale(idx int, now time.Time) bool {
+	legs := d.cycles[idx].legs()
+	oldest := d.updated[legs[0][0]][legs[0][1]]
+	newest := oldest
+
+	for _, leg := range legs[1:] {
+		at := d.updated[leg[0]][leg[1]]
+
+		if at.Before(oldest) {
+			oldest = at
+		}
+
+		if at.After(newest) {
+			newest = at
+		}
+	}
+
+	if d.maxAge > 0 && now.Sub(oldest) > d.maxAge {
+		return true
+	}
+
+	return d.maxSkew > 0 && newest.Sub(oldest) > d.maxSkew
+}
+
+// convert converts an amount from one currency to another at the last known
+// rate between them. It is false if there is no such rate.
+func (d *detector) convert(amount float64, from, to int) (float64, bool) {
+	rate := d.rates.At(from, to)
+	if rate == 0 {
+		return 0, false
+	}
+
+	return amount * rate, true
+}
@@ -0,0 +1,78 @@
+package tabot
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_detector(t *testing.T) {
+	// USD, BTC, ETH, EUR
+	d := newDetector(4, []cycle{{0, 1, 2}, {0, 2, 1}, {0, 1, 2, 3}})
+	now := time.Now()
+
+	if got := d.update(0, 1, 1.0/50000, 1e9, now); !reflect.DeepEqual(got, []int{0, 2}) {
+		t.Errorf("update() affected = %v, want [0 2]", got)
+	}
+
+	d.update(1, 2, 20, 1e9, now)
+	d.update(2, 0, 2510, 1e9, now)
+
+	if got := d.rank([]int{0, 1, 2}); !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("rank() = %v, want [0] as the other cycles miss rates", got)
+	}
+
+	if got := d.rate(0); math.Abs(got-1.004) > 1e-9 {
+		t.Errorf("rate() = %v, want 1.004", got)
+	}
+
+	// The four leg cycle becomes the better one
+	d.update(2, 3, 2400, 1e9, now)
+	d.update(3, 0, 1.1, 1e9, now)
+
+	if got := d.rank([]int{0, 1, 2}); !reflect.DeepEqual(got, []int{2, 0}) {
+		t.Errorf("rank() = %v, want [2 0]", got)
+	}
+
+	// A single tick turns the triangle unprofitable
+	affected := d.update(2, 0, 2490, 1e9, now)
+
+	if got := d.rank(affected); len(got) != 0 {
+		t.Errorf("rank() = %v after the rate dropped, want none", got)
+	}
+}
+
+func Test_detector_stale(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		maxAge  time.Duration
+		maxSkew time.Duration
+		ticked  []time.Duration
+		want    bool
+	}{
+		{"No limits", 0, 0, []time.Duration{time.Hour, 0, 0}, false},
+		{"Fresh", 10 * time.Second, 5 * time.Second, []time.Duration{3 * time.Second, 2 * time.Second, 0}, false},
+		{"Too old", 10 * time.Second, 0, []time.Duration{11 * time.Second, 11 * time.Second, 11 * time.Second}, true},
+		{"Too far apart", 0, 5 * time.Second, []time.Duration{6 * time.Second, 0, 0}, true},
+		{"Never ticked", 10 * time.Second, 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDetector(3, []cycle{{0, 1, 2}})
+			d.maxAge, d.maxSkew = tt.maxAge, tt.maxSkew
+
+			for idx, ago := range tt.ticked {
+				leg := d.cycles[0].legs()[idx]
+				d.update(leg[0], leg[1], 1, 1, now.Add(-ago))
+			}
+
+			if got := d.stale(0, now); got != tt.want {
+				t.Errorf("stale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
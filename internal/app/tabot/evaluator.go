@@ -0,0 +1,27 @@
+package tabot
+
+// bps is the number of basis points in 1.
+const bps = 10000
+
+// Evaluator decides whether an opportunity is worth trading. Opportunities
+// are evaluated after fees and the slippage of walking the books.
+type Evaluator interface {
+	Tradeable(o Opportunity) bool
+}
+
+// ProfitEvaluator accepts opportunities with a positive net edge of at least
+// MinEdgeBps basis points and a profit of at least MinProfit in the reporting
+// currency. With a MinProfit set, opportunities whose profit cannot be
+// converted to the reporting currency are rejected.
+type ProfitEvaluator struct {
+	MinEdgeBps float64
+	MinProfit  float64
+}
+
+func (e ProfitEvaluator) Tradeable(o Opportunity) bool {
+	if o.EdgeBps <= 0 || o.EdgeBps < e.MinEdgeBps {
+		return false
+	}
+
+	return e.MinProfit <= 0 || o.ProfitReporting >= e.MinProfit
+}
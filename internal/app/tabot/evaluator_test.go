@@ -0,0 +1,29 @@
+package tabot
+
+import "testing"
+
+func TestProfitEvaluator_Tradeable(t *testing.T) {
+	tests := []struct {
+		name      string
+		evaluator ProfitEvaluator
+		o         Opportunity
+		want      bool
+	}{
+		{"Positive edge", ProfitEvaluator{}, Opportunity{EdgeBps: 0.5}, true},
+		{"Eaten by fees", ProfitEvaluator{}, Opportunity{EdgeBps: -3}, false},
+		{"Break even", ProfitEvaluator{}, Opportunity{EdgeBps: 0}, false},
+		{"Below min edge", ProfitEvaluator{MinEdgeBps: 5}, Opportunity{EdgeBps: 4}, false},
+		{"At min edge", ProfitEvaluator{MinEdgeBps: 5}, Opportunity{EdgeBps: 5}, true},
+		{"Below min profit", ProfitEvaluator{MinProfit: 1}, Opportunity{EdgeBps: 10, ProfitReporting: 0.5}, false},
+		{"Above min profit", ProfitEvaluator{MinProfit: 1}, Opportunity{EdgeBps: 10, ProfitReporting: 2}, true},
+		{"Profit not converted", ProfitEvaluator{MinProfit: 1}, Opportunity{EdgeBps: 10, Profit: 2}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.evaluator.Tradeable(tt.o); got != tt.want {
+				t.Errorf("Tradeable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
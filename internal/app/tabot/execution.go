@@ -0,0 +1,353 @@
+package tabot
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ExecutionMode is how the legs of a cycle are executed.
+type ExecutionMode string
+
+const (
+	// ExecutionOff only reports opportunities.
+	ExecutionOff ExecutionMode = ""
+
+	// ExecutionSequential waits for each leg to fill and trades what it
+	// returned in the next one.
+	ExecutionSequential ExecutionMode = "sequential"
+
+	// ExecutionParallel places all legs at once, sized by the expected
+	// rates.
+	ExecutionParallel ExecutionMode = "parallel"
+)
+
+var (
+	ErrUnknownMode = errors.New("unknown execution mode")
+	ErrNotFilled   = errors.New("leg not filled")
+)
+
+// LegResult is the outcome of a leg of a cycle. Rates convert the currency the
+// leg sells to the one it buys, before fees. They are the rate the leg was
+// sized by and the one of its fill.
+type LegResult struct {
+	Pair         string
+	Side         string
+	Qty          float64
+	Filled       float64
+	ExpectedRate float64
+	RealizedRate float64
+	Fee          float64
+	FeeAsset     string
+	Err          error
+}
+
+// CycleResult is the outcome of executing a cycle. Amounts are in the anchor
+// currency. Fees and NetPnL convert the other currencies at the last known
+// rates, leaving out the ones without a rate to the anchor.
+type CycleResult struct {
+	Cycle          string
+	Anchor         string
+	Mode           ExecutionMode
+	Legs           []LegResult
+	Notional       float64
+	ExpectedProfit float64
+	Fees           float64
+	NetPnL         float64
+	Err            error
+
+	// Residuals are the amounts of other currencies than the anchor the
+	// cycle bought, or sold if negative, and did not trade on
+	Residuals map[string]float64
+}
+
+// legOrder is the order of a directed leg. Rate is the average rate the leg
+// is expected to fill at, limit the worst one it accepts, both before fees.
+type legOrder struct {
+	leg   [2]int
+	pair  string
+	rate  float64
+	limit float64
+	input ExecutionInput
+}
+
+// order returns the order converting amount of the currency the leg sells.
+// The pair is sold into the bid if the leg sells its base, otherwise the base
+// is bought from the ask. The order is sized at the average rate of the levels
+// the amount takes and limited at the worst of them, less the slippage
+// tolerance, so that it fills as deep as the opportunity was sized.
+func (t *TriangleBot) order(g graph, d *detector, leg [2]int, amount float64) (legOrder, error) {
+	pair := g.pair(leg)
+
+	base, quote, err := t.normalizer.Pair(pair)
+	if err != nil {
+		return legOrder{}, err
+	}
+
+	o := legOrder{
+		leg:  leg,
+		pair: pair,
+		input: ExecutionInput{
+			Symbol:            base,
+			Base:              quote,
+			ImmediateOrCancel: true,
+		},
+	}
+
+	average, worst := t.ladder(g, d, leg, 0).walk(amount)
+	o.rate, o.limit = average, worst*(1-t.toleranceBps/bps)
+
+	if o.rate <= 0 {
+		// Without liquidity to walk, the order goes out at the top of the book
+		o.rate = d.rates.At(leg[0], leg[1])
+		o.limit = o.rate * (1 - t.toleranceBps/bps)
+	}
+
+	if o.rate <= 0 {
+		return legOrder{}, errors.Wrapf(ErrNotFilled, "no rate for %s", pair)
+	}
+
+	if g.symbols[leg[0]] == base {
+		o.input.Side = "sell"
+		o.input.Rate = o.limit
+		o.input.Qty = amount
+
+		return o, nil
+	}
+
+	o.input.Side = "buy"
+	o.input.Rate = 1 / o.limit
+	o.input.Qty = amount * o.rate
+
+	return o, nil
+}
+
+// fill returns the amounts the leg sold and bought by the fill, fees
+// included, and its result.
+func (o legOrder) fill(result ExecutionResult, err error) (float64, float64, LegResult) {
+	leg := LegResult{
+		Pair:         o.pair,
+		Side:         o.input.Side,
+		Qty:          o.input.Qty,
+		Filled:       result.Qty,
+		ExpectedRate: o.rate,
+		Fee:          result.Fee,
+		FeeAsset:     result.FeeAsset,
+		Err:          err,
+	}
+
+	if leg.FeeAsset == "" {
+		leg.FeeAsset = o.input.Base
+	}
+
+	if result.Qty <= 0 || result.Price <= 0 {
+		if leg.Err == nil {
+			leg.Err = errors.Wrap(ErrNotFilled, o.pair)
+		}
+
+		return 0, 0, leg
+	}
+
+	baseAmount, quoteAmount := result.Qty, result.Qty*result.Price
+
+	var sold, bought float64
+
+	if o.input.Side == "sell" {
+		leg.RealizedRate = result.Price
+		sold, bought = baseAmount, quoteAmount
+	} else {
+		leg.RealizedRate = 1 / result.Price
+		sold, bought = quoteAmount, baseAmount
+	}
+
+	// A fee in the currency bought reduces what the leg returns, in the one
+	// sold it adds to what it costs
+	soldAsset := o.input.Symbol
+	if o.input.Side == "buy" {
+		soldAsset = o.input.Base
+	}
+
+	if leg.FeeAsset == soldAsset {
+		sold += leg.Fee
+	} else {
+		bought -= leg.Fee
+	}
+
+	return sold, bought, leg
+}
+
+// ledger books the fills of legs.
+type ledger struct {
+	legs []LegResult
+	err  error
+
+	// flows are the net amounts traded per currency, by its index
+	flows map[int]float64
+	fees  map[string]float64
+}
+
+func newLedger() *ledger {
+	return &ledger{
+		flows: make(map[int]float64),
+		fees:  make(map[string]float64),
+	}
+}
+
+// book records the fill of the order and returns the amount it bought.
+func (l *ledger) book(order legOrder, res ExecutionResult, err error) float64 {
+	sold, bought, leg := order.fill(res, err)
+
+	l.flows[order.leg[0]] -= sold
+	l.flows[order.leg[1]] += bought
+	l.fees[leg.FeeAsset] += leg.Fee
+
+	l.legs = append(l.legs, leg)
+
+	if leg.Err != nil && l.err == nil {
+		l.err = leg.Err
+	}
+
+	return bought
+}
+
+// value returns the net amount traded and the fees paid in the anchor, at the
+// last known rates. Currencies without a rate to the anchor are left out.
+func (l *ledger) value(g graph, d *detector, anchor int) (float64, float64) {
+	var pnl, paid float64
+
+	for cur, flow := range l.flows {
+		converted, ok := d.convert(flow, cur, anchor)
+		if ok {
+			pnl += converted
+		}
+	}
+
+	for asset, fee := range l.fees {
+		idx, err := index(asset, g.symbols)
+		if err != nil {
+			continue
+		}
+
+		converted, ok := d.convert(fee, idx, anchor)
+		if ok {
+			paid += converted
+		}
+	}
+
+	return pnl, paid
+}
+
+// trade executes the legs one after the other, each selling what the previous
+// one bought, starting with amount. It stops at the first leg that fails or
+// does not fill.
+func (t *TriangleBot) trade(ctx context.Context, g graph, d *detector, l *ledger, legs [][2]int, amount float64) {
+	for _, leg := range legs {
+		order, err := t.order(g, d, leg, amount)
+		if err != nil {
+			if l.err == nil {
+				l.err = err
+			}
+
+			return
+		}
+
+		res, err := t.executeLeg(ctx, order)
+
+		amount = l.book(order, res, err)
+		if l.err != nil {
+			return
+		}
+	}
+}
+
+// executeLeg places the order of a leg, waiting at most the leg timeout for
+// it to fill, so that an order whose outcome never arrives does not stall
+// the bot.
+func (t *TriangleBot) executeLeg(ctx context.Context, order legOrder) (ExecutionResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.legTimeout)
+	defer cancel()
+
+	return t.trader.Execute(ctx, order.input)
+}
+
+// execute trades the opportunity around its cycle in the configured mode.
+// Sequential execution stops at the first leg that fails or does not fill.
+// Whatever the cycle leaves over outside of the anchor is reported as its
+// residuals.
+func (t *TriangleBot) execute(ctx context.Context, g graph, d *detector, o Opportunity) CycleResult {
+	c := g.cycles[o.idx]
+	legs := c.legs()
+
+	result := CycleResult{
+		Cycle:          o.Cycle,
+		Anchor:         o.Anchor,
+		Mode:           t.mode,
+		Notional:       o.Notional,
+		ExpectedProfit: o.Profit,
+	}
+
+	l := newLedger()
+
+	switch t.mode {
+	case ExecutionSequential:
+		t.trade(ctx, g, d, l, legs, o.Notional)
+	case ExecutionParallel:
+		orders := make([]legOrder, 0, len(legs))
+		amount := o.Notional
+
+		for legIdx, leg := range legs {
+			order, err := t.order(g, d, leg, amount)
+			if err != nil {
+				result.Err = err
+
+				return result
+			}
+
+			orders = append(orders, order)
+			amount *= order.rate * (1 - o.legFees[legIdx])
+		}
+
+		results := make([]ExecutionResult, len(orders))
+		errs := make([]error, len(orders))
+
+		var wg sync.WaitGroup
+
+		for idx, order := range orders {
+			wg.Add(1)
+
+			go func(idx int, order legOrder) {
+				defer wg.Done()
+
+				results[idx], errs[idx] = t.executeLeg(ctx, order)
+			}(idx, order)
+		}
+
+		wg.Wait()
+
+		for idx, order := range orders {
+			l.book(order, results[idx], errs[idx])
+		}
+	default:
+		result.Err = errors.Wrap(ErrUnknownMode, string(t.mode))
+
+		return result
+	}
+
+	result.Legs, result.Err = l.legs, l.err
+	result.NetPnL, result.Fees = l.value(g, d, c[0])
+
+	for cur, flow := range l.flows {
+		if cur == c[0] || flow == 0 {
+			continue
+		}
+
+		if result.Residuals == nil {
+			result.Residuals = make(map[string]float64)
+		}
+
+		result.Residuals[g.symbols[cur]] = flow
+	}
+
+	return result
+}
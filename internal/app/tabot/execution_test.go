@@ -0,0 +1,268 @@
+package tabot
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/peetermeos/tabot/internal/pkg/orderbook"
+	"github.com/peetermeos/tabot/internal/pkg/symbol"
+	"github.com/pkg/errors"
+)
+
+// filler fills every order at its rate, charging the fee in the base. The
+// order with the index failAt fails.
+type filler struct {
+	mu     sync.Mutex
+	fee    float64
+	failAt int
+	inputs []ExecutionInput
+}
+
+var errFailed = errors.New("failed")
+
+func (f *filler) Execute(_ context.Context, input ExecutionInput) (ExecutionResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.inputs = append(f.inputs, input)
+	if len(f.inputs) == f.failAt {
+		return ExecutionResult{}, errFailed
+	}
+
+	return ExecutionResult{
+		Qty:      input.Qty,
+		Price:    input.Rate,
+		Fee:      input.Qty * input.Rate * f.fee,
+		FeeAsset: input.Base,
+	}, nil
+}
+
+func (f *filler) TotalCapital() float64 {
+	return 0
+}
+
+// stalled fills half of every order and nothing more, returning that once
+// ctx is done.
+type stalled struct{}
+
+func (stalled) Execute(ctx context.Context, input ExecutionInput) (ExecutionResult, error) {
+	<-ctx.Done()
+
+	return ExecutionResult{Qty: input.Qty / 2, Price: input.Rate, FeeAsset: input.Base}, ctx.Err()
+}
+
+func (stalled) TotalCapital() float64 {
+	return 0
+}
+
+// books serves fixed order books.
+type books map[string]*orderbook.Book
+
+func (b books) SubscribeBook(context.Context, string) error {
+	return nil
+}
+
+func (b books) OrderBook(symbol string) (*orderbook.Book, bool) {
+	book, ok := b[symbol]
+
+	return book, ok
+}
+
+func TestTriangleBot_order(t *testing.T) {
+	g := graph{
+		symbols: []string{"USD", "BTC"},
+		pairs:   map[edge]string{newEdge(0, 1): "BTC/USD"},
+	}
+
+	d := newDetector(len(g.symbols), nil)
+	d.update(0, 1, 1.0/50100, 1, time.Now())
+	d.update(1, 0, 50000, 1, time.Now())
+
+	book := orderbook.New("BTC/USD", 10)
+	book.ApplySnapshot(
+		[]orderbook.Level{{Price: 50000, Volume: 1}, {Price: 49900, Volume: 2}},
+		[]orderbook.Level{{Price: 50100, Volume: 1}, {Price: 50200, Volume: 2}},
+	)
+
+	tests := []struct {
+		name         string
+		leg          [2]int
+		amount       float64
+		toleranceBps float64
+		side         string
+		qty          float64
+		limit        float64
+	}{
+		{"Sell at the top", [2]int{1, 0}, 0.5, 0, "sell", 0.5, 50000},
+		{"Sell through the second level", [2]int{1, 0}, 2, 0, "sell", 2, 49900},
+		// 10 bps below the worst bid
+		{"Sell with tolerance", [2]int{1, 0}, 2, 10, "sell", 2, 49900 * 0.999},
+		{"Buy at the top", [2]int{0, 1}, 25050, 0, "buy", 0.5, 50100},
+		// The average ask is (50100 + 50200) / 2
+		{"Buy through the second level", [2]int{0, 1}, 100300, 0, "buy", 2, 50200},
+		{"Buy with tolerance", [2]int{0, 1}, 100300, 10, "buy", 2, 50200 / 0.999},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &TriangleBot{
+				books:        books{"BTC/USD": book},
+				toleranceBps: tt.toleranceBps,
+				normalizer:   symbol.NewNormalizer(symbol.KrakenAliases, nil, g.symbols...),
+			}
+
+			got, err := bot.order(g, d, tt.leg, tt.amount)
+			if err != nil {
+				t.Fatalf("order() error = %v", err)
+			}
+
+			if got.input.Side != tt.side || math.Abs(got.input.Qty-tt.qty) > 1e-9 {
+				t.Errorf("order() = %+v, want %s %v", got.input, tt.side, tt.qty)
+			}
+
+			if math.Abs(got.input.Rate-tt.limit) > 1e-6 {
+				t.Errorf("order() limit = %v, want %v", got.input.Rate, tt.limit)
+			}
+		})
+	}
+}
+
+func TestTriangleBot_execute_legTimeout(t *testing.T) {
+	g := graph{
+		symbols: []string{"USD", "BTC", "ETH"},
+		pairs: map[edge]string{
+			newEdge(0, 1): "BTC/USD",
+			newEdge(1, 2): "ETH/BTC",
+			newEdge(0, 2): "ETH/USD",
+		},
+		cycles: []cycle{{0, 1, 2}},
+	}
+
+	now := time.Now()
+	d := newDetector(len(g.symbols), g.cycles)
+	d.update(0, 1, 1.0/50000, 1e6, now)
+	d.update(1, 2, 20, 1e6, now)
+	d.update(2, 0, 2550, 1e6, now)
+
+	bot := &TriangleBot{
+		trader:     stalled{},
+		mode:       ExecutionSequential,
+		legTimeout: 10 * time.Millisecond,
+		normalizer: symbol.NewNormalizer(symbol.KrakenAliases, nil, g.symbols...),
+	}
+
+	got := bot.execute(context.Background(), g, d, Opportunity{Cycle: "USD/BTC/ETH", Anchor: "USD", Notional: 1000})
+	if !errors.Is(got.Err, context.DeadlineExceeded) {
+		t.Errorf("execute() error = %v, want %v", got.Err, context.DeadlineExceeded)
+	}
+
+	if len(got.Legs) != 1 {
+		t.Fatalf("execute() legs = %d, want 1", len(got.Legs))
+	}
+
+	// Half the BTC was bought before the leg timed out
+	if math.Abs(got.Legs[0].Filled-0.01) > 1e-12 || math.Abs(got.Residuals["BTC"]-0.01) > 1e-12 {
+		t.Errorf("execute() filled = %v, residuals = %v, want 0.01 BTC", got.Legs[0].Filled, got.Residuals)
+	}
+}
+
+func TestTriangleBot_execute(t *testing.T) {
+	// USD -> BTC -> ETH -> USD returns 2% before fees
+	g := graph{
+		symbols: []string{"USD", "BTC", "ETH"},
+		pairs: map[edge]string{
+			newEdge(0, 1): "BTC/USD",
+			newEdge(1, 2): "ETH/BTC",
+			newEdge(0, 2): "ETH/USD",
+		},
+		cycles: []cycle{{0, 1, 2}},
+	}
+
+	now := time.Now()
+	d := newDetector(len(g.symbols), g.cycles)
+	d.update(0, 1, 1.0/50000, 1e6, now)
+	d.update(1, 0, 50000, 1e6, now)
+	d.update(1, 2, 20, 1e6, now)
+	d.update(2, 0, 2550, 1e6, now)
+
+	o := Opportunity{
+		Cycle:    "USD/BTC/ETH",
+		Anchor:   "USD",
+		Notional: 1000,
+		Profit:   20,
+		legFees:  []float64{0.001, 0.001, 0.001},
+	}
+
+	tests := []struct {
+		name    string
+		mode    ExecutionMode
+		fee     float64
+		failAt  int
+		legs    int
+		wantPnL float64
+		wantErr error
+	}{
+		{"Sequential without fees", ExecutionSequential, 0, 0, 3, 20, nil},
+		// Fees of 1 USD, 0.00002 BTC and 1.02 USD
+		{"Sequential", ExecutionSequential, 0.001, 0, 3, 16.98, nil},
+		{"Sequential stops at failed leg", ExecutionSequential, 0, 2, 2, 0, errFailed},
+		// Legs are sized by the expected fees, what they leave over is
+		// valued at the last rates
+		{"Parallel without fees", ExecutionParallel, 0, 0, 3, 19.98, nil},
+		{"Parallel keeps other legs", ExecutionParallel, 0, 2, 3, 0, errFailed},
+		{"Off", ExecutionOff, 0, 0, 0, 0, ErrUnknownMode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trader := &filler{fee: tt.fee, failAt: tt.failAt}
+			bot := &TriangleBot{
+				trader:     trader,
+				mode:       tt.mode,
+				legTimeout: time.Second,
+				normalizer: symbol.NewNormalizer(symbol.KrakenAliases, nil, g.symbols...),
+			}
+
+			got := bot.execute(context.Background(), g, d, o)
+			if !errors.Is(got.Err, tt.wantErr) {
+				t.Fatalf("execute() error = %v, want %v", got.Err, tt.wantErr)
+			}
+
+			if len(got.Legs) != tt.legs {
+				t.Fatalf("execute() legs = %d, want %d", len(got.Legs), tt.legs)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if math.Abs(got.NetPnL-tt.wantPnL) > 1e-6 {
+				t.Errorf("execute() net PnL = %v, want %v", got.NetPnL, tt.wantPnL)
+			}
+
+			if tt.mode != ExecutionSequential {
+				return
+			}
+
+			if math.Abs(got.Fees-(got.ExpectedProfit-got.NetPnL)) > 1e-6 {
+				t.Errorf("execute() fees = %v, want %v", got.Fees, got.ExpectedProfit-got.NetPnL)
+			}
+
+			for _, leg := range got.Legs {
+				if math.Abs(leg.RealizedRate-leg.ExpectedRate) > 1e-9 {
+					t.Errorf("execute() leg %s realized rate = %v, want %v", leg.Pair, leg.RealizedRate, leg.ExpectedRate)
+				}
+			}
+
+			sides := []string{"buy", "buy", "sell"}
+			for idx, input := range trader.inputs {
+				if input.Side != sides[idx] || !input.ImmediateOrCancel {
+					t.Errorf("execute() order %d = %+v", idx, input)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package tabot
+
+import (
+	"sort"
+	"strings"
+)
+
+// Pair is a currency pair listed on the exchange. Base and Quote are
+// canonical currency codes.
+type Pair struct {
+	Symbol string
+	Base   string
+	Quote  string
+}
+
+// edge connects two currencies, given by their index, regardless of the
+// orientation of the pair quoting them.
+type edge struct {
+	lower int
+	upper int
+}
+
+func newEdge(idx1, idx2 int) edge {
+	if idx1 > idx2 {
+		idx1, idx2 = idx2, idx1
+	}
+
+	return edge{lower: idx1, upper: idx2}
+}
+
+// cycle is a closed sequence of currencies, given by their index, in trading
+// order. The first currency is the anchor the cycle starts and ends in, it is
+// not repeated at the end.
+type cycle []int
+
+// legs returns the directed legs of the cycle in trading order.
+func (c cycle) legs() [][2]int {
+	legs := make([][2]int, len(c))
+
+	for idx := range c {
+		legs[idx] = [2]int{c[idx], c[(idx+1)%len(c)]}
+	}
+
+	return legs
+}
+
+// graph is the currency graph built from the pairs listed on the exchange,
+// reduced to the currencies and pairs of the cycles through the anchors.
+type graph struct {
+	symbols []string
+	pairs   map[edge]string
+	cycles  []cycle
+}
+
+// discover builds the graph of all cycles starting at any of the anchors with
+// three up to maxLegs legs from the listed pairs. If allowed is not empty, only
+// the allowed currencies and the anchors are considered. The enumeration stops
+// once it found more than maxCycles cycles.
+func discover(listed []Pair, anchors []string, allowed []string, maxLegs, maxCycles int) graph {
+	isAllowed := make(map[string]bool, len(allowed)+len(anchors))
+	for _, sym := range append(append([]string(nil), allowed...), anchors...) {
+		isAllowed[sym] = true
+	}
+
+	// pairOf maps each currency to the currencies it trades against and the
+	// symbol of the pair between them
+	pairOf := make(map[string]map[string]string)
+
+	for _, pair := range listed {
+		if pair.Base == pair.Quote {
+			continue
+		}
+
+		if len(allowed) > 0 && (!isAllowed[pair.Base] || !isAllowed[pair.Quote]) {
+			continue
+		}
+
+		for _, cur := range []string{pair.Base, pair.Quote} {
+			if pairOf[cur] == nil {
+				pairOf[cur] = make(map[string]string)
+			}
+		}
+
+		pairOf[pair.Base][pair.Quote] = pair.Symbol
+		pairOf[pair.Quote][pair.Base] = pair.Symbol
+	}
+
+	// Neighbours are sorted to keep the enumeration order stable
+	neighbours := make(map[string][]string, len(pairOf))
+
+	for cur, others := range pairOf {
+		for other := range others {
+			neighbours[cur] = append(neighbours[cur], other)
+		}
+
+		sort.Strings(neighbours[cur])
+	}
+
+	var paths [][]string
+
+	onPath := make(map[string]bool)
+
+	var walk func(path []string)
+
+	walk = func(path []string) {
+		for _, next := range neighbours[path[len(path)-1]] {
+			if len(paths) > maxCycles {
+				return
+			}
+
+			if next == path[0] && len(path) >= 3 {
+				paths = append(paths, append([]string(nil), path...))
+
+				continue
+			}
+
+			if onPath[next] || len(path) == maxLegs {
+				continue
+			}
+
+			onPath[next] = true
+			walk(append(path, next))
+			onPath[next] = false
+		}
+	}
+
+	for _, anchor := range anchors {
+		onPath[anchor] = true
+		walk([]string{anchor})
+		onPath[anchor] = false
+	}
+
+	// The anchors come first, the rest is sorted to keep the indices stable
+	g := graph{
+		symbols: append([]string(nil), anchors...),
+		pairs:   make(map[edge]string),
+	}
+
+	members := make(map[string]bool)
+
+	for _, path := range paths {
+		for _, cur := range path {
+			members[cur] = true
+		}
+	}
+
+	for _, anchor := range anchors {
+		delete(members, anchor)
+	}
+
+	others := make([]string, 0, len(members))
+
+	for cur := range members {
+		others = append(others, cur)
+	}
+
+	sort.Strings(others)
+
+	g.symbols = append(g.symbols, others...)
+
+	indices := make(map[string]int, len(g.symbols))
+	for idx, cur := range g.symbols {
+		indices[cur] = idx
+	}
+
+	// Shorter cycles first, as they are cheaper to trade
+	sort.SliceStable(paths, func(i, j int) bool { return len(paths[i]) < len(paths[j]) })
+
+	for _, path := range paths {
+		c := make(cycle, len(path))
+
+		for idx, cur := range path {
+			c[idx] = indices[cur]
+		}
+
+		for _, leg := range c.legs() {
+			from, to := g.symbols[leg[0]], g.symbols[leg[1]]
+			g.pairs[newEdge(leg[0], leg[1])] = pairOf[from][to]
+		}
+
+		g.cycles = append(g.cycles, c)
+	}
+
+	return g
+}
+
+// link adds the listed pair between two currencies, so that amounts can be
+// converted between them. It is false if no such pair is listed.
+func (g *graph) link(listed []Pair, from, to string) bool {
+	for _, pair := range listed {
+		if (pair.Base != from || pair.Quote != to) && (pair.Base != to || pair.Quote != from) {
+			continue
+		}
+
+		indices := make([]int, 0, 2)
+
+		for _, cur := range []string{from, to} {
+			idx, err := index(cur, g.symbols)
+			if err != nil {
+				idx = len(g.symbols)
+				g.symbols = append(g.symbols, cur)
+			}
+
+			indices = append(indices, idx)
+		}
+
+		g.pairs[newEdge(indices[0], indices[1])] = pair.Symbol
+
+		return true
+	}
+
+	return false
+}
+
+// pair returns the symbol of the pair traded by the leg.
+func (g graph) pair(leg [2]int) string {
+	return g.pairs[newEdge(leg[0], leg[1])]
+}
+
+// names returns the currencies of the cycle, separated by slashes.
+func (g graph) names(c cycle) string {
+	names := make([]string, len(c))
+
+	for idx, cur := range c {
+		names[idx] = g.symbols[cur]
+	}
+
+	return strings.Join(names, "/")
+}
+
+// subscriptions returns the symbols of all pairs the cycles trade, sorted.
+func (g graph) subscriptions() []string {
+	symbols := make([]string, 0, len(g.pairs))
+
+	for _, symbol := range g.pairs {
+		symbols = append(symbols, symbol)
+	}
+
+	sort.Strings(symbols)
+
+	return symbols
+}
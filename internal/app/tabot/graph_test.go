@@ -0,0 +1,148 @@
+package tabot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_discover(t *testing.T) {
+	listed := []Pair{
+		{"BTC/USD", "BTC", "USD"},
+		{"ETH/USD", "ETH", "USD"},
+		{"ETH/BTC", "ETH", "BTC"},
+		{"EUR/USD", "EUR", "USD"},
+		{"BTC/EUR", "BTC", "EUR"},
+		{"SOL/BTC", "SOL", "BTC"},
+	}
+
+	tests := []struct {
+		name        string
+		allowed     []string
+		wantSymbols []string
+		wantPairs   []string
+		wantCycles  []cycle
+	}{
+		{
+			name:        "All currencies",
+			wantSymbols: []string{"USD", "BTC", "ETH", "EUR"},
+			wantPairs:   []string{"BTC/EUR", "BTC/USD", "ETH/BTC", "ETH/USD", "EUR/USD"},
+			wantCycles: []cycle{
+				{0, 1, 2}, {0, 1, 3}, {0, 2, 1}, {0, 3, 1},
+			},
+		},
+		{
+			name:        "Allowed currencies",
+			allowed:     []string{"USD", "BTC", "EUR", "SOL"},
+			wantSymbols: []string{"USD", "BTC", "EUR"},
+			wantPairs:   []string{"BTC/EUR", "BTC/USD", "EUR/USD"},
+			wantCycles:  []cycle{{0, 1, 2}, {0, 2, 1}},
+		},
+		{
+			name:        "No triangles",
+			allowed:     []string{"USD", "SOL", "BTC"},
+			wantSymbols: []string{"USD"},
+			wantPairs:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := discover(listed, []string{"USD"}, tt.allowed, 3, maxCycles)
+
+			if !reflect.DeepEqual(g.symbols, tt.wantSymbols) {
+				t.Errorf("discover() symbols = %v, want %v", g.symbols, tt.wantSymbols)
+			}
+
+			if got := g.subscriptions(); !reflect.DeepEqual(got, tt.wantPairs) {
+				t.Errorf("discover() pairs = %v, want %v", got, tt.wantPairs)
+			}
+
+			if !reflect.DeepEqual(g.cycles, tt.wantCycles) {
+				t.Errorf("discover() cycles = %v, want %v", g.cycles, tt.wantCycles)
+			}
+		})
+	}
+}
+
+func Test_discover_maxLegs(t *testing.T) {
+	// USD -> BTC -> ETH -> EUR -> USD is the only cycle, with four legs
+	listed := []Pair{
+		{"BTC/USD", "BTC", "USD"},
+		{"ETH/BTC", "ETH", "BTC"},
+		{"ETH/EUR", "ETH", "EUR"},
+		{"USD/EUR", "USD", "EUR"},
+	}
+
+	if g := discover(listed, []string{"USD"}, nil, 3, maxCycles); len(g.cycles) != 0 {
+		t.Errorf("discover() with 3 legs cycles = %v, want none", g.cycles)
+	}
+
+	// The enumeration stops past the limit
+	if g := discover(listed, []string{"USD"}, nil, 4, 0); len(g.cycles) != 1 {
+		t.Errorf("discover() past the limit cycles = %v, want one", g.cycles)
+	}
+
+	g := discover(listed, []string{"USD"}, nil, 4, maxCycles)
+
+	if got := len(g.cycles); got != 2 {
+		t.Fatalf("discover() with 4 legs cycles = %v, want both directions", g.cycles)
+	}
+
+	if got := g.names(g.cycles[0]); got != "USD/BTC/ETH/EUR" {
+		t.Errorf("names() = %s, want USD/BTC/ETH/EUR", got)
+	}
+
+	// The inverted USD/EUR pair still connects USD and EUR
+	if got := g.pair([2]int{3, 0}); got != "USD/EUR" {
+		t.Errorf("pair() of EUR and USD = %s, want USD/EUR", got)
+	}
+}
+
+func Test_discover_anchors(t *testing.T) {
+	listed := []Pair{
+		{"BTC/USD", "BTC", "USD"},
+		{"BTC/EUR", "BTC", "EUR"},
+		{"ETH/BTC", "ETH", "BTC"},
+		{"ETH/EUR", "ETH", "EUR"},
+		{"EUR/USD", "EUR", "USD"},
+	}
+
+	g := discover(listed, []string{"EUR", "USD"}, []string{"BTC", "ETH"}, 3, maxCycles)
+
+	if want := []string{"EUR", "USD", "BTC", "ETH"}; !reflect.DeepEqual(g.symbols, want) {
+		t.Errorf("discover() symbols = %v, want %v", g.symbols, want)
+	}
+
+	anchors := make(map[string]int)
+	for _, c := range g.cycles {
+		anchors[g.symbols[c[0]]]++
+	}
+
+	// EUR/BTC/ETH, EUR/BTC/USD and back, USD/BTC/EUR and back
+	if anchors["EUR"] != 4 || anchors["USD"] != 2 {
+		t.Errorf("discover() cycles per anchor = %v", anchors)
+	}
+}
+
+func Test_graph_link(t *testing.T) {
+	listed := []Pair{
+		{"BTC/EUR", "BTC", "EUR"},
+		{"ETH/BTC", "ETH", "BTC"},
+		{"ETH/EUR", "ETH", "EUR"},
+		{"EUR/USD", "EUR", "USD"},
+	}
+
+	g := discover(listed, []string{"EUR"}, nil, 3, maxCycles)
+
+	if !g.link(listed, "EUR", "USD") {
+		t.Fatal("link() = false, want true")
+	}
+
+	if got := g.pair([2]int{0, len(g.symbols) - 1}); got != "EUR/USD" {
+		t.Errorf("pair() of EUR and USD = %s, want EUR/USD", got)
+	}
+
+	if g.link(listed, "EUR", "GBP") {
+		t.Error("link() = true for an unlisted pair")
+	}
+}
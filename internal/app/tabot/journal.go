@@ -0,0 +1,98 @@
+package tabot
+
+import "time"
+
+// SkipReason is why a detected opportunity was not executed.
+type SkipReason string
+
+const (
+	SkipStale        SkipReason = "stale_quotes"
+	SkipNotTradeable SkipReason = "not_tradeable"
+	SkipExecutionOff SkipReason = "execution_off"
+	SkipNoCapital    SkipReason = "no_capital"
+	SkipOutranked    SkipReason = "outranked"
+	SkipInFlight     SkipReason = "in_flight"
+)
+
+// Journal persists the opportunities the bot detects, executed or not.
+type Journal interface {
+	Record(entry JournalEntry) error
+}
+
+// JournalLeg is a leg of a journaled opportunity with the rate it was
+// evaluated at, the amount of the currency sold the rate takes and the time
+// of the tick that set them.
+type JournalLeg struct {
+	Pair     string    `json:"pair"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Rate     float64   `json:"rate"`
+	Depth    float64   `json:"depth"`
+	TickTime time.Time `json:"tick_time"`
+}
+
+// JournalEntry is a detected opportunity and what became of it. Edges are in
+// basis points, gross before fees and net after fees and slippage. Amounts
+// are in the anchor currency.
+type JournalEntry struct {
+	Time        time.Time    `json:"time"`
+	Cycle       string       `json:"cycle"`
+	Anchor      string       `json:"anchor"`
+	Legs        []JournalLeg `json:"legs"`
+	GrossBps    float64      `json:"gross_bps"`
+	NetBps      float64      `json:"net_bps"`
+	SlippageBps float64      `json:"slippage_bps"`
+	MaxNotional float64      `json:"max_notional"`
+	Notional    float64      `json:"notional"`
+	Profit      float64      `json:"profit"`
+	Executed    bool         `json:"executed"`
+	Skipped     SkipReason   `json:"skipped,omitempty"`
+	NetPnL      float64      `json:"net_pnl,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// record journals the opportunity as detected at the given time, skipped for
+// the given reason or executed with the given result.
+func (t *TriangleBot) record(g graph, d *detector, o Opportunity, now time.Time, skipped SkipReason, result *CycleResult) {
+	if t.journal == nil {
+		return
+	}
+
+	entry := JournalEntry{
+		Time:        now,
+		Cycle:       o.Cycle,
+		Anchor:      o.Anchor,
+		GrossBps:    (o.Rate - 1) * bps,
+		NetBps:      o.EdgeBps,
+		SlippageBps: o.SlippageBps,
+		MaxNotional: o.MaxNotional,
+		Notional:    o.Notional,
+		Profit:      o.Profit,
+		Skipped:     skipped,
+	}
+
+	for _, leg := range g.cycles[o.idx].legs() {
+		entry.Legs = append(entry.Legs, JournalLeg{
+			Pair:     g.pair(leg),
+			From:     g.symbols[leg[0]],
+			To:       g.symbols[leg[1]],
+			Rate:     d.rates.At(leg[0], leg[1]),
+			Depth:    d.depths.At(leg[0], leg[1]),
+			TickTime: d.updated[leg[0]][leg[1]],
+		})
+	}
+
+	if result != nil {
+		entry.Executed = true
+		entry.NetPnL = result.NetPnL
+
+		if result.Err != nil {
+			entry.Error = result.Err.Error()
+		}
+	}
+
+	err := t.journal.Record(entry)
+	if err != nil {
+		t.logger.WithError(err).Warn("failed to journal opportunity")
+	}
+}
@@ -0,0 +1,190 @@
+package tabot
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/peetermeos/tabot/internal/pkg/fees"
+	"github.com/peetermeos/tabot/internal/pkg/symbol"
+	"github.com/sirupsen/logrus"
+)
+
+// memoryJournal keeps the recorded entries.
+type memoryJournal []JournalEntry
+
+func (m *memoryJournal) Record(entry JournalEntry) error {
+	*m = append(*m, entry)
+
+	return nil
+}
+
+func TestTriangleBot_evaluate_journal(t *testing.T) {
+	g := graph{
+		symbols: []string{"USD", "BTC", "ETH"},
+		pairs: map[edge]string{
+			newEdge(0, 1): "BTC/USD",
+			newEdge(1, 2): "ETH/BTC",
+			newEdge(0, 2): "ETH/USD",
+		},
+		cycles: []cycle{{0, 1, 2}, {0, 2, 1}},
+	}
+
+	tests := []struct {
+		name       string
+		mode       ExecutionMode
+		minEdgeBps float64
+		maxAge     time.Duration
+		want       map[string]SkipReason
+		executed   string
+	}{
+		{
+			name:   "Execution off",
+			maxAge: 10 * time.Second,
+			want:   map[string]SkipReason{"USD/BTC/ETH": SkipExecutionOff, "USD/ETH/BTC": SkipStale},
+		},
+		{
+			name:       "Not tradeable",
+			minEdgeBps: 500,
+			maxAge:     10 * time.Second,
+			want:       map[string]SkipReason{"USD/BTC/ETH": SkipNotTradeable, "USD/ETH/BTC": SkipStale},
+		},
+		{
+			name:     "Outranked",
+			mode:     ExecutionSequential,
+			want:     map[string]SkipReason{"USD/BTC/ETH": "", "USD/ETH/BTC": SkipOutranked},
+			executed: "USD/BTC/ETH",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Both directions are profitable, by 2% and 1%, the ETH -> BTC
+			// rate of the second one is old
+			now := time.Now()
+			d := newDetector(len(g.symbols), g.cycles)
+			d.maxAge = tt.maxAge
+			d.update(0, 1, 1.0/50000, 1e6, now)
+			d.update(1, 2, 20, 1e6, now)
+			d.update(2, 0, 2550, 1e6, now)
+			d.update(0, 2, 1.0/2500, 1e6, now)
+			d.update(2, 1, 0.0505, 1e6, now.Add(-time.Minute))
+			d.update(1, 0, 50000, 1e6, now)
+
+			journal := &memoryJournal{}
+			bot := &TriangleBot{
+				logger:     logrus.New(),
+				trader:     &filler{},
+				fees:       fees.NewModel([]fees.Tier{{Rates: fees.Rates{Taker: 0.001}}}, 0),
+				evaluator:  ProfitEvaluator{MinEdgeBps: tt.minEdgeBps},
+				mode:       tt.mode,
+				journal:    journal,
+				normalizer: symbol.NewNormalizer(symbol.KrakenAliases, nil, g.symbols...),
+				events:     make(chan RecoveryEvent, eventBufferSize),
+			}
+
+			bot.evaluate(context.Background(), g, d, []int{0, 1}, now)
+			bot.inflight.Wait()
+
+			got := make(map[string]SkipReason)
+			for _, entry := range *journal {
+				got[entry.Cycle] = entry.Skipped
+
+				if entry.Executed != (entry.Cycle == tt.executed) {
+					t.Errorf("evaluate() %s executed = %v", entry.Cycle, entry.Executed)
+				}
+
+				if len(entry.Legs) != 3 || entry.Legs[0].TickTime.IsZero() || entry.GrossBps <= 0 {
+					t.Errorf("evaluate() entry = %+v", entry)
+				}
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evaluate() journaled %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// gated fills orders like filler once the gate opens.
+type gated struct {
+	filler
+	gate chan struct{}
+}
+
+func (g *gated) Execute(ctx context.Context, input ExecutionInput) (ExecutionResult, error) {
+	select {
+	case <-g.gate:
+	case <-ctx.Done():
+		return ExecutionResult{}, ctx.Err()
+	}
+
+	return g.filler.Execute(ctx, input)
+}
+
+func TestTriangleBot_evaluate_inFlight(t *testing.T) {
+	g := graph{
+		symbols: []string{"USD", "BTC", "ETH"},
+		pairs: map[edge]string{
+			newEdge(0, 1): "BTC/USD",
+			newEdge(1, 2): "ETH/BTC",
+			newEdge(0, 2): "ETH/USD",
+		},
+		cycles: []cycle{{0, 1, 2}},
+	}
+
+	now := time.Now()
+	d := newDetector(len(g.symbols), g.cycles)
+	d.update(0, 1, 1.0/50000, 1e6, now)
+	d.update(1, 0, 50000, 1e6, now)
+	d.update(1, 2, 20, 1e6, now)
+	d.update(2, 0, 2550, 1e6, now)
+
+	trader := &gated{gate: make(chan struct{})}
+	journal := &memoryJournal{}
+	bot := &TriangleBot{
+		logger:     logrus.New(),
+		trader:     trader,
+		fees:       fees.NewModel([]fees.Tier{{Rates: fees.Rates{Taker: 0.001}}}, 0),
+		evaluator:  ProfitEvaluator{},
+		mode:       ExecutionSequential,
+		legTimeout: time.Second,
+		journal:    journal,
+		normalizer: symbol.NewNormalizer(symbol.KrakenAliases, nil, g.symbols...),
+		events:     make(chan RecoveryEvent, eventBufferSize),
+	}
+
+	bot.evaluate(context.Background(), g, d, []int{0}, now)
+
+	// The tick loop moves on while the first leg waits for its fill
+	evaluated := make(chan struct{})
+
+	go func() {
+		d.update(2, 0, 2560, 1e6, now.Add(time.Second))
+		bot.evaluate(context.Background(), g, d, []int{0}, now.Add(time.Second))
+		close(evaluated)
+	}()
+
+	select {
+	case <-evaluated:
+	case <-time.After(time.Second):
+		t.Fatal("evaluate() blocked on the cycle in flight")
+	}
+
+	close(trader.gate)
+	bot.inflight.Wait()
+
+	got := make([]SkipReason, 0, len(*journal))
+	for _, entry := range *journal {
+		got = append(got, entry.Skipped)
+	}
+
+	if want := []SkipReason{SkipInFlight, ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("evaluate() journaled %v, want %v", got, want)
+	}
+
+	if (*journal)[1].Legs[2].Rate != 2550 {
+		t.Errorf("evaluate() journaled the executed cycle at %v, want the rates it was traded at", (*journal)[1].Legs[2].Rate)
+	}
+}
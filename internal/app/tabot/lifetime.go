@@ -0,0 +1,115 @@
+package tabot
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OpportunityLifetime follows an opportunity from the tick its cycle first
+// became tradeable to the first tick it no longer was. The peak is the best
+// net edge in between.
+type OpportunityLifetime struct {
+	Cycle       string
+	Anchor      string
+	Opened      time.Time
+	Closed      time.Time
+	Duration    time.Duration
+	PeakEdgeBps float64
+	PeakAt      time.Time
+	Ticks       int
+	Executed    bool
+}
+
+// ClosedOpportunities returns the lifetimes of the opportunities that closed.
+func (t *TriangleBot) ClosedOpportunities() <-chan OpportunityLifetime {
+	return t.closed
+}
+
+// track opens a lifetime for each tradeable opportunity not open yet, updates
+// the peaks of the open ones and closes those of the affected cycles that are
+// no longer tradeable. Open cycles whose quotes went stale are closed as well,
+// as no tick may touch them again. It reports whether each opportunity just
+// opened.
+func (t *TriangleBot) track(d *detector, affected []int, tradeable []Opportunity, now time.Time) map[int]bool {
+	if t.open == nil {
+		t.open = make(map[int]*OpportunityLifetime)
+	}
+
+	opened := make(map[int]bool, len(tradeable))
+	current := make(map[int]bool, len(tradeable))
+
+	for _, o := range tradeable {
+		current[o.idx] = true
+
+		lifetime, ok := t.open[o.idx]
+		if !ok {
+			lifetime = &OpportunityLifetime{
+				Cycle:       o.Cycle,
+				Anchor:      o.Anchor,
+				Opened:      now,
+				PeakEdgeBps: o.EdgeBps,
+				PeakAt:      now,
+			}
+
+			t.open[o.idx] = lifetime
+			opened[o.idx] = true
+		}
+
+		lifetime.Ticks++
+
+		if o.EdgeBps > lifetime.PeakEdgeBps {
+			lifetime.PeakEdgeBps, lifetime.PeakAt = o.EdgeBps, now
+		}
+	}
+
+	closing := append([]int(nil), affected...)
+
+	stale := make([]int, 0, len(t.open))
+	for idx := range t.open {
+		if !current[idx] && d.stale(idx, now) {
+			stale = append(stale, idx)
+		}
+	}
+
+	sort.Ints(stale)
+
+	for _, idx := range append(closing, stale...) {
+		lifetime, ok := t.open[idx]
+		if !ok || current[idx] {
+			continue
+		}
+
+		delete(t.open, idx)
+
+		lifetime.Closed = now
+		lifetime.Duration = now.Sub(lifetime.Opened)
+
+		t.closeOpportunity(*lifetime)
+	}
+
+	return opened
+}
+
+// closeOpportunity logs the closed opportunity and publishes it, dropping it
+// if nobody keeps up with the events.
+func (t *TriangleBot) closeOpportunity(lifetime OpportunityLifetime) {
+	logger := t.logger.WithFields(logrus.Fields{
+		"cycle":         lifetime.Cycle,
+		"anchor":        lifetime.Anchor,
+		"duration":      lifetime.Duration,
+		"peak_edge_bps": lifetime.PeakEdgeBps,
+		"peak_after":    lifetime.PeakAt.Sub(lifetime.Opened),
+		"ticks":         lifetime.Ticks,
+		"executed":      lifetime.Executed,
+	})
+
+	logger.Info("opportunity closed")
+
+	select {
+	case t.closed <- lifetime:
+	default:
+		logger.Debug("dropping closed opportunity")
+	}
+}
@@ -0,0 +1,111 @@
+package tabot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestTriangleBot_track(t *testing.T) {
+	bot := &TriangleBot{
+		logger: logrus.New(),
+		closed: make(chan OpportunityLifetime, eventBufferSize),
+	}
+
+	d := newDetector(3, []cycle{{0, 1, 2}, {0, 2, 1}})
+
+	start := time.Now()
+	first := Opportunity{Cycle: "USD/BTC/ETH", Anchor: "USD", idx: 0}
+	second := Opportunity{Cycle: "USD/ETH/BTC", Anchor: "USD", idx: 1}
+
+	steps := []struct {
+		affected   []int
+		tradeable  []Opportunity
+		wantOpened map[int]bool
+	}{
+		{[]int{0, 1}, []Opportunity{withEdge(first, 10), withEdge(second, 5)}, map[int]bool{0: true, 1: true}},
+		{[]int{0}, []Opportunity{withEdge(first, 30)}, map[int]bool{}},
+		{[]int{0}, []Opportunity{withEdge(first, 20)}, map[int]bool{}},
+		// The second cycle was not ticked and stays open
+		{[]int{0}, nil, map[int]bool{}},
+	}
+
+	for idx, step := range steps {
+		now := start.Add(time.Duration(idx) * time.Second)
+
+		if got := bot.track(d, step.affected, step.tradeable, now); !reflect.DeepEqual(got, step.wantOpened) {
+			t.Errorf("track() step %d opened = %v, want %v", idx, got, step.wantOpened)
+		}
+	}
+
+	want := OpportunityLifetime{
+		Cycle:       "USD/BTC/ETH",
+		Anchor:      "USD",
+		Opened:      start,
+		Closed:      start.Add(3 * time.Second),
+		Duration:    3 * time.Second,
+		PeakEdgeBps: 30,
+		PeakAt:      start.Add(time.Second),
+		Ticks:       3,
+	}
+
+	if got := <-bot.ClosedOpportunities(); !reflect.DeepEqual(got, want) {
+		t.Errorf("track() closed = %+v, want %+v", got, want)
+	}
+
+	if len(bot.closed) != 0 || len(bot.open) != 1 {
+		t.Errorf("track() closed %d more, %d open, want 0 and 1", len(bot.closed), len(bot.open))
+	}
+}
+
+func TestTriangleBot_track_stale(t *testing.T) {
+	bot := &TriangleBot{
+		logger: logrus.New(),
+		closed: make(chan OpportunityLifetime, eventBufferSize),
+	}
+
+	start := time.Now()
+
+	d := newDetector(3, []cycle{{0, 1, 2}, {0, 2, 1}})
+	d.maxAge = 5 * time.Second
+
+	for from := 0; from < 3; from++ {
+		for to := 0; to < 3; to++ {
+			if from != to {
+				d.update(from, to, 1, 1, start)
+			}
+		}
+	}
+
+	first := Opportunity{Cycle: "USD/BTC/ETH", Anchor: "USD", idx: 0}
+	second := Opportunity{Cycle: "USD/ETH/BTC", Anchor: "USD", idx: 1}
+
+	bot.track(d, []int{0, 1}, []Opportunity{first, second}, start)
+
+	// No tick touches the cycles again, yet their quotes go stale
+	bot.track(d, nil, nil, start.Add(time.Second))
+
+	if len(bot.closed) != 0 {
+		t.Fatalf("track() closed %d before the quotes went stale", len(bot.closed))
+	}
+
+	bot.track(d, nil, nil, start.Add(10*time.Second))
+
+	for _, want := range []string{"USD/BTC/ETH", "USD/ETH/BTC"} {
+		if got := <-bot.ClosedOpportunities(); got.Cycle != want || got.Duration != 10*time.Second {
+			t.Errorf("track() closed = %+v, want %s after 10s", got, want)
+		}
+	}
+
+	if len(bot.open) != 0 {
+		t.Errorf("track() left %d open", len(bot.open))
+	}
+}
+
+func withEdge(o Opportunity, edgeBps float64) Opportunity {
+	o.EdgeBps = edgeBps
+
+	return o
+}
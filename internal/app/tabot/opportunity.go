@@ -0,0 +1,113 @@
+package tabot
+
+import "math"
+
+// Opportunity is a profitable cycle. Amounts are in the anchor currency, the
+// cycle starts and ends in, unless stated otherwise.
+type Opportunity struct {
+	Cycle  string
+	Anchor string
+	Legs   int
+
+	// Rate is the gross return of trading around the cycle, NetRate the
+	// return after fees. 1 is break even.
+	Rate    float64
+	NetRate float64
+
+	// MaxNotional is the notional the available liquidity makes the most of,
+	// Notional the part of it the capital covers.
+	MaxNotional float64
+	Notional    float64
+	Profit      float64
+
+	// EdgeBps is the return at the notional after fees and slippage,
+	// SlippageBps what walking the books costs compared to the best rates.
+	EdgeBps     float64
+	SlippageBps float64
+
+	// ProfitReporting is the profit in the reporting currency, zero if the
+	// rate between the anchor and the reporting currency is not known yet.
+	Reporting       string
+	ProfitReporting float64
+
+	// idx is the index of the cycle in the graph, legFees the fees of its
+	// legs
+	idx     int
+	legFees []float64
+}
+
+// opportunity describes the cycle, sized by the liquidity of its legs and the
+// capital of the execution provider, converted from the reporting currency to
+// the anchor. If the capital cannot be converted, it is sized by the liquidity
+// only.
+func (t *TriangleBot) opportunity(g graph, d *detector, idx int, legFees []float64) Opportunity {
+	c := g.cycles[idx]
+
+	o := Opportunity{
+		Cycle:     g.names(c),
+		Anchor:    g.symbols[c[0]],
+		Legs:      len(c),
+		Rate:      d.rate(idx),
+		Reporting: t.reporting,
+		idx:       idx,
+		legFees:   legFees,
+	}
+
+	o.NetRate = o.Rate
+	for _, fee := range legFees {
+		o.NetRate *= 1 - fee
+	}
+
+	ladders := make([]ladder, 0, len(c))
+	for legIdx, leg := range c.legs() {
+		ladders = append(ladders, t.ladder(g, d, leg, legFees[legIdx]))
+	}
+
+	o.MaxNotional, o.Profit = size(ladders)
+	o.Notional = o.MaxNotional
+
+	reportingIdx, err := index(t.reporting, g.symbols)
+	if err == nil {
+		capital, ok := d.convert(t.trader.TotalCapital(), reportingIdx, c[0])
+		if ok && capital < o.Notional {
+			o.Notional = capital
+			o.Profit = profit(ladders, capital)
+		}
+
+		o.ProfitReporting, _ = d.convert(o.Profit, c[0], reportingIdx)
+	}
+
+	// Without liquidity, the edge is the one at the best rates
+	o.EdgeBps = (o.NetRate - 1) * bps
+
+	if o.Notional > 0 {
+		effective := (o.Notional + o.Profit) / o.Notional
+		o.EdgeBps = (effective - 1) * bps
+		o.SlippageBps = (o.NetRate - effective) * bps
+	}
+
+	return o
+}
+
+// ladder returns the liquidity of the leg, from the L2 book of its pair if
+// there is one, otherwise from the top of the book.
+func (t *TriangleBot) ladder(g graph, d *detector, leg [2]int, fee float64) ladder {
+	if t.books != nil {
+		pair := g.pair(leg)
+
+		book, ok := t.books.OrderBook(pair)
+		if ok {
+			base, _, err := t.normalizer.Pair(pair)
+			if err == nil {
+				return bookLadder(book, g.symbols[leg[0]] == base, fee)
+			}
+		}
+	}
+
+	rate := d.rates.At(leg[0], leg[1])
+	if rate == 0 {
+		return nil
+	}
+
+	return ladder{{rate: rate * (1 - fee), capacity: math.Max(d.depths.At(leg[0], leg[1]), 0)}}
+}
@@ -0,0 +1,72 @@
+package tabot
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+type fixedCapital float64
+
+func (f fixedCapital) Execute(_ context.Context, _ ExecutionInput) (ExecutionResult, error) {
+	return ExecutionResult{}, nil
+}
+
+func (f fixedCapital) TotalCapital() float64 {
+	return float64(f)
+}
+
+func TestTriangleBot_opportunity(t *testing.T) {
+	// EUR, USD, BTC, ETH with EUR as the anchor and USD for reporting
+	g := graph{
+		symbols: []string{"EUR", "USD", "BTC", "ETH"},
+		cycles:  []cycle{{0, 2, 3}},
+	}
+
+	legFees := []float64{0.001, 0.001, 0.001}
+
+	// BTC -> ETH only takes 0.01 BTC at the top of the book
+	d := newDetector(len(g.symbols), g.cycles)
+	now := time.Now()
+	d.update(0, 2, 1.0/50000, 1e6, now)
+	d.update(2, 3, 20, 0.01, now)
+	d.update(3, 0, 2550, 1e6, now)
+
+	bot := &TriangleBot{trader: fixedCapital(1100), reporting: "USD"}
+
+	o := bot.opportunity(g, d, 0, legFees)
+	if o.Anchor != "EUR" || o.Cycle != "EUR/BTC/ETH" || o.Legs != 3 {
+		t.Errorf("opportunity() = %+v", o)
+	}
+
+	wantNet := 1.02 * math.Pow(0.999, 3)
+	if math.Abs(o.NetRate-wantNet) > 1e-9 {
+		t.Errorf("opportunity() net rate = %v, want %v", o.NetRate, wantNet)
+	}
+
+	// Sized by the BTC -> ETH leg without a rate to convert the capital
+	wantMax := 0.01 * 50000 / 0.999
+	if math.Abs(o.MaxNotional-wantMax) > 1e-6 || o.Notional != o.MaxNotional || o.ProfitReporting != 0 {
+		t.Errorf("opportunity() without conversion rates = %+v", o)
+	}
+
+	if math.Abs(o.Profit-wantMax*(wantNet-1)) > 1e-6 {
+		t.Errorf("opportunity() profit = %v, want %v", o.Profit, wantMax*(wantNet-1))
+	}
+
+	// 330 USD is 300 EUR, less than the liquidity allows
+	d.update(1, 0, 1/1.1, 1e6, now)
+	d.update(0, 1, 1.1, 1e6, now)
+
+	bot.trader = fixedCapital(330)
+
+	o = bot.opportunity(g, d, 0, legFees)
+	if math.Abs(o.Notional-300) > 1e-9 || math.Abs(o.MaxNotional-wantMax) > 1e-6 {
+		t.Errorf("opportunity() notional = %v, max %v", o.Notional, o.MaxNotional)
+	}
+
+	if math.Abs(o.Profit-300*(wantNet-1)) > 1e-9 || math.Abs(o.ProfitReporting-1.1*o.Profit) > 1e-9 {
+		t.Errorf("opportunity() = %+v", o)
+	}
+}
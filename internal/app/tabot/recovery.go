@@ -0,0 +1,305 @@
+package tabot
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RecoveryAction is what is done with the residual of a broken cycle.
+type RecoveryAction string
+
+const (
+	// RecoveryComplete trades the residual through the remaining legs of
+	// its cycle back to the anchor.
+	RecoveryComplete RecoveryAction = "complete"
+
+	// RecoveryUnwind trades the residual directly back to the anchor.
+	RecoveryUnwind RecoveryAction = "unwind"
+
+	// RecoveryHold keeps the residual until recovering it gets cheaper.
+	RecoveryHold RecoveryAction = "hold"
+)
+
+const (
+	// eventBufferSize is the number of recovery events kept for a slow
+	// consumer.
+	eventBufferSize = 64
+
+	// dust is the share of a residual's value below which what recovering
+	// it left over is ignored.
+	dust = 1e-9
+)
+
+// RecoveryPolicy decides how to recover the residuals of broken cycles, the
+// currencies a cycle left over because a leg failed or filled in part.
+// Residuals are recovered the way that returns the most at the current
+// prices, unless they are worth less than MinValue or recovering them costs
+// more than MaxCostBps of their value, in which case they are held. Zero
+// values disable the limits.
+type RecoveryPolicy struct {
+	MinValue   float64
+	MaxCostBps float64
+}
+
+// RecoveryEvent records the recovery of a residual. Value is the residual at
+// the last known rate to the anchor, Expected what recovering it was expected
+// to return and Proceeds what it did, net of what it left over. Cost is the
+// difference between Value and Proceeds. Amounts are in the anchor currency.
+type RecoveryEvent struct {
+	Time     time.Time
+	Cycle    string
+	Anchor   string
+	Currency string
+	Amount   float64
+	Action   RecoveryAction
+	Value    float64
+	Expected float64
+	Proceeds float64
+	Cost     float64
+	Legs     []LegResult
+	Err      error
+}
+
+// Decide chooses how to recover a residual of the given value from the
+// expected returns of completing and unwinding it, negative infinity for an
+// option that is not available. It returns the action and its expected
+// return.
+func (p RecoveryPolicy) Decide(value, complete, unwind float64) (RecoveryAction, float64) {
+	if math.Abs(value) < p.MinValue {
+		return RecoveryHold, 0
+	}
+
+	action, expected := RecoveryUnwind, unwind
+	if complete > unwind {
+		action, expected = RecoveryComplete, complete
+	}
+
+	if math.IsInf(expected, -1) {
+		return RecoveryHold, 0
+	}
+
+	if p.MaxCostBps > 0 && value != 0 && (value-expected)/math.Abs(value)*bps > p.MaxCostBps {
+		return RecoveryHold, expected
+	}
+
+	return action, expected
+}
+
+// residual is an amount of a currency a broken cycle left over, negative if
+// the cycle sold more of it than it bought.
+type residual struct {
+	cycle    int
+	currency int
+	amount   float64
+}
+
+// RecoveryEvents returns the recoveries of broken cycles.
+func (t *TriangleBot) RecoveryEvents() <-chan RecoveryEvent {
+	return t.events
+}
+
+// residuals returns the residuals of the executed cycle, sorted by currency.
+func (t *TriangleBot) residuals(g graph, o Opportunity, result CycleResult) []residual {
+	currencies := make([]string, 0, len(result.Residuals))
+
+	for cur := range result.Residuals {
+		currencies = append(currencies, cur)
+	}
+
+	sort.Strings(currencies)
+
+	residuals := make([]residual, 0, len(currencies))
+
+	for _, cur := range currencies {
+		idx, err := index(cur, g.symbols)
+		if err != nil {
+			continue
+		}
+
+		residuals = append(residuals, residual{cycle: o.idx, currency: idx, amount: result.Residuals[cur]})
+	}
+
+	return residuals
+}
+
+// recoverHeld retries the residuals held so far at the current prices.
+func (t *TriangleBot) recoverHeld(ctx context.Context, g graph, d *detector) {
+	held := t.held
+	t.held = nil
+
+	for _, r := range held {
+		t.recover(ctx, g, d, r, true)
+	}
+}
+
+// recover completes, unwinds or holds the residual as the policy decides.
+// Residuals worth less than the policy minimum are dust and left as they are.
+// Held residuals are retried on later ticks, a hold is only recorded the first
+// time.
+func (t *TriangleBot) recover(ctx context.Context, g graph, d *detector, r residual, retry bool) {
+	c := g.cycles[r.cycle]
+	anchor := c[0]
+
+	value, ok := d.convert(r.amount, r.currency, anchor)
+	if !ok || math.Abs(value) < t.recovery.MinValue {
+		return
+	}
+
+	unwindLegs, unwindAmount, unwind := t.unwind(g, d, r, anchor)
+	completeLegs, complete := t.complete(g, d, r)
+
+	event := RecoveryEvent{
+		Time:     time.Now(),
+		Cycle:    g.names(c),
+		Anchor:   g.symbols[anchor],
+		Currency: g.symbols[r.currency],
+		Amount:   r.amount,
+		Value:    value,
+	}
+
+	event.Action, event.Expected = t.recovery.Decide(value, complete, unwind)
+
+	switch event.Action {
+	case RecoveryHold:
+		t.held = append(t.held, r)
+
+		if retry {
+			return
+		}
+	case RecoveryUnwind:
+		t.settle(ctx, g, d, &event, r, unwindLegs, unwindAmount)
+	case RecoveryComplete:
+		t.settle(ctx, g, d, &event, r, completeLegs, r.amount)
+	}
+
+	t.emit(event)
+}
+
+// unwind returns the leg trading the residual directly back to the anchor,
+// the amount it sells and its expected return. A negative residual is bought
+// back with the anchor.
+func (t *TriangleBot) unwind(g graph, d *detector, r residual, anchor int) ([][2]int, float64, float64) {
+	if g.pairs[newEdge(r.currency, anchor)] == "" {
+		return nil, 0, math.Inf(-1)
+	}
+
+	if r.amount > 0 {
+		leg := [2]int{r.currency, anchor}
+
+		rate := d.rates.At(leg[0], leg[1])
+		if rate <= 0 {
+			return nil, 0, math.Inf(-1)
+		}
+
+		return [][2]int{leg}, r.amount, r.amount * rate * (1 - t.fees.Taker(g.pair(leg)))
+	}
+
+	leg := [2]int{anchor, r.currency}
+
+	rate := d.rates.At(leg[0], leg[1])
+	if rate <= 0 {
+		return nil, 0, math.Inf(-1)
+	}
+
+	cost := -r.amount / (rate * (1 - t.fees.Taker(g.pair(leg))))
+
+	return [][2]int{leg}, cost, -cost
+}
+
+// complete returns the remaining legs of the cycle from the residual back to
+// the anchor and their expected return. Negative residuals cannot be
+// completed.
+func (t *TriangleBot) complete(g graph, d *detector, r residual) ([][2]int, float64) {
+	if r.amount <= 0 {
+		return nil, math.Inf(-1)
+	}
+
+	legs := g.cycles[r.cycle].legs()
+
+	for idx, leg := range legs {
+		if leg[0] != r.currency {
+			continue
+		}
+
+		expected := r.amount
+
+		for _, remaining := range legs[idx:] {
+			expected *= d.rates.At(remaining[0], remaining[1]) * (1 - t.fees.Taker(g.pair(remaining)))
+		}
+
+		if expected <= 0 {
+			return nil, math.Inf(-1)
+		}
+
+		return legs[idx:], expected
+	}
+
+	return nil, math.Inf(-1)
+}
+
+// settle trades the legs of the recovery and books its proceeds and cost.
+// What a failed recovery leaves over is held again.
+func (t *TriangleBot) settle(ctx context.Context, g graph, d *detector, event *RecoveryEvent, r residual, legs [][2]int, amount float64) {
+	l := newLedger()
+	l.flows[r.currency] = r.amount
+
+	t.trade(ctx, g, d, l, legs, amount)
+
+	anchor := g.cycles[r.cycle][0]
+
+	event.Legs, event.Err = l.legs, l.err
+	event.Proceeds = l.flows[anchor]
+
+	for cur, flow := range l.flows {
+		if cur == anchor {
+			continue
+		}
+
+		converted, ok := d.convert(flow, cur, anchor)
+		if ok {
+			event.Proceeds += converted
+		}
+
+		// Rounding leaves dust of the currencies traded through
+		if l.err != nil && flow != 0 && (!ok || math.Abs(converted) > dust*math.Abs(event.Value)) {
+			t.held = append(t.held, residual{cycle: r.cycle, currency: cur, amount: flow})
+		}
+	}
+
+	event.Cost = event.Value - event.Proceeds
+}
+
+// emit logs the recovery event and publishes it, dropping it if nobody keeps
+// up with the events.
+func (t *TriangleBot) emit(event RecoveryEvent) {
+	logger := t.logger.WithFields(logrus.Fields{
+		"cycle":    event.Cycle,
+		"currency": event.Currency,
+		"amount":   event.Amount,
+		"action":   event.Action,
+		"value":    event.Value,
+		"expected": event.Expected,
+		"proceeds": event.Proceeds,
+		"cost":     event.Cost,
+		"anchor":   event.Anchor,
+	})
+
+	switch {
+	case event.Err != nil:
+		logger.WithError(event.Err).Warn("failed to recover broken cycle")
+	case event.Action == RecoveryHold:
+		logger.Info("holding residual of broken cycle")
+	default:
+		logger.Info("recovered broken cycle")
+	}
+
+	select {
+	case t.events <- event:
+	default:
+		logger.Debug("dropping recovery event")
+	}
+}
@@ -0,0 +1,136 @@
+package tabot
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/peetermeos/tabot/internal/pkg/fees"
+	"github.com/peetermeos/tabot/internal/pkg/symbol"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestRecoveryPolicy_Decide(t *testing.T) {
+	unavailable := math.Inf(-1)
+
+	tests := []struct {
+		name         string
+		policy       RecoveryPolicy
+		value        float64
+		complete     float64
+		unwind       float64
+		want         RecoveryAction
+		wantExpected float64
+	}{
+		{"Complete returns more", RecoveryPolicy{}, 100, 101, 99, RecoveryComplete, 101},
+		{"Unwind on a tie", RecoveryPolicy{}, 100, 99, 99, RecoveryUnwind, 99},
+		{"Dust", RecoveryPolicy{MinValue: 10}, 5, 6, 5, RecoveryHold, 0},
+		{"Nothing available", RecoveryPolicy{}, 100, unavailable, unavailable, RecoveryHold, 0},
+		{"Too costly", RecoveryPolicy{MaxCostBps: 50}, 100, unavailable, 99, RecoveryHold, 99},
+		{"Within cost", RecoveryPolicy{MaxCostBps: 150}, 100, unavailable, 99, RecoveryUnwind, 99},
+		{"Buy back", RecoveryPolicy{MaxCostBps: 150}, -100, unavailable, -101, RecoveryUnwind, -101},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, expected := tt.policy.Decide(tt.value, tt.complete, tt.unwind)
+			if got != tt.want || expected != tt.wantExpected {
+				t.Errorf("Decide() = %v, %v, want %v, %v", got, expected, tt.want, tt.wantExpected)
+			}
+		})
+	}
+}
+
+func TestTriangleBot_recover(t *testing.T) {
+	g := graph{
+		symbols: []string{"USD", "BTC", "ETH"},
+		pairs: map[edge]string{
+			newEdge(0, 1): "BTC/USD",
+			newEdge(1, 2): "ETH/BTC",
+			newEdge(0, 2): "ETH/USD",
+		},
+		cycles: []cycle{{0, 1, 2}},
+	}
+
+	tests := []struct {
+		name     string
+		policy   RecoveryPolicy
+		amount   float64
+		ethRate  float64
+		failAt   int
+		want     RecoveryAction
+		wantCost float64
+		wantHeld int
+		wantLog  string
+	}{
+		// 0.02 BTC is worth 1000 USD, 1020 USD through ETH
+		{"Complete", RecoveryPolicy{MaxCostBps: 50}, 0.02, 20, 0, RecoveryComplete, -20, 0, "recovered broken cycle"},
+		{"Unwind", RecoveryPolicy{MaxCostBps: 50}, 0.02, 19, 0, RecoveryUnwind, 0, 0, "recovered broken cycle"},
+		{"Hold", RecoveryPolicy{MaxCostBps: 5}, 0.02, 19, 0, RecoveryHold, 0, 1, "holding residual of broken cycle"},
+		{"Buy back", RecoveryPolicy{MaxCostBps: 50}, -0.02, 19, 0, RecoveryUnwind, 0, 0, "recovered broken cycle"},
+		{"Dust", RecoveryPolicy{MinValue: 2000}, 0.02, 20, 0, "", 0, 0, ""},
+		// Stuck with ETH after the first leg of completing
+		{"Failed", RecoveryPolicy{}, 0.02, 20, 2, RecoveryComplete, 1000 - 0.4*2550, 1, "failed to recover broken cycle"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			d := newDetector(len(g.symbols), g.cycles)
+			d.update(0, 1, 1.0/50000, 1e6, now)
+			d.update(1, 0, 50000, 1e6, now)
+			d.update(1, 2, tt.ethRate, 1e6, now)
+			d.update(2, 0, 2550, 1e6, now)
+
+			logger, hook := logtest.NewNullLogger()
+
+			bot := &TriangleBot{
+				logger:     logger,
+				trader:     &filler{failAt: tt.failAt},
+				fees:       fees.NewModel([]fees.Tier{{Rates: fees.Rates{Taker: 0.001}}}, 0),
+				recovery:   tt.policy,
+				normalizer: symbol.NewNormalizer(symbol.KrakenAliases, nil, g.symbols...),
+				events:     make(chan RecoveryEvent, eventBufferSize),
+			}
+
+			bot.recover(context.Background(), g, d, residual{currency: 1, amount: tt.amount}, false)
+
+			if len(bot.held) != tt.wantHeld {
+				t.Errorf("recover() held = %v, want %d", bot.held, tt.wantHeld)
+			}
+
+			if tt.want == "" {
+				if len(bot.events) != 0 {
+					t.Errorf("recover() recorded %d events for dust", len(bot.events))
+				}
+
+				return
+			}
+
+			event := <-bot.events
+			if event.Action != tt.want || (event.Err != nil) != (tt.failAt > 0) {
+				t.Fatalf("recover() event = %+v, want %v", event, tt.want)
+			}
+
+			if math.Abs(event.Cost-tt.wantCost) > 1e-6 {
+				t.Errorf("recover() cost = %v, want %v", event.Cost, tt.wantCost)
+			}
+
+			if entry := hook.LastEntry(); entry == nil || entry.Message != tt.wantLog {
+				t.Errorf("recover() logged %v, want %q", entry, tt.wantLog)
+			}
+
+			if tt.want != RecoveryHold {
+				return
+			}
+
+			// Held residuals are retried without recording the hold again
+			bot.recoverHeld(context.Background(), g, d)
+
+			if len(bot.held) != tt.wantHeld || len(bot.events) != 0 {
+				t.Errorf("recoverHeld() held = %v, events = %d", bot.held, len(bot.events))
+			}
+		})
+	}
+}
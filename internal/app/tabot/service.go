@@ -3,20 +3,26 @@ package tabot
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/peetermeos/tabot/internal/pkg/fees"
+	"github.com/peetermeos/tabot/internal/pkg/symbol"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"gonum.org/v1/gonum/mat"
 )
 
 type MarketDataProvider interface {
 	Stream(ctx context.Context) <-chan Tick
-	Subscribe(symbol string) error
-	Unsubscribe(symbol string) error
+	Subscribe(ctx context.Context, symbol string) error
+	Unsubscribe(ctx context.Context, symbol string) error
+	Pairs(ctx context.Context) ([]Pair, error)
 }
 
 type ExecutionProvider interface {
-	Execute(ctx context.Context, input ExecutionInput) error
+	Execute(ctx context.Context, input ExecutionInput) (ExecutionResult, error)
 	TotalCapital() float64
 }
 
@@ -26,6 +32,20 @@ type ExecutionInput struct {
 	Side   string
 	Rate   float64
 	Qty    float64
+
+	// ImmediateOrCancel cancels the part of a limit order that does not fill
+	// right away.
+	ImmediateOrCancel bool
+}
+
+// ExecutionResult is the fill of an order. Qty is the filled amount of the
+// symbol at the average Price, Fee the fee charged in FeeAsset. Without a
+// FeeAsset, the fee is charged in the base.
+type ExecutionResult struct {
+	Qty      float64
+	Price    float64
+	Fee      float64
+	FeeAsset string
 }
 
 type Tick struct {
@@ -34,58 +54,292 @@ type Tick struct {
 	BidQty float64
 	Ask    float64
 	AskQty float64
+
+	// Time is when the quote was received, the time it is evaluated at if
+	// not set.
+	Time time.Time
 }
 
 type TriangleBot struct {
 	logger     logrus.FieldLogger
 	marketData MarketDataProvider
 	trader     ExecutionProvider
+	books      BookProvider
+	fees       *fees.Model
+	evaluator  Evaluator
+	mode       ExecutionMode
+	recovery   RecoveryPolicy
+	journal    Journal
 	symbols    []string
+	anchors    []string
+	reporting  string
+	maxLegs    int
+	normalizer *symbol.Normalizer
+
+	maxQuoteAge  time.Duration
+	maxQuoteSkew time.Duration
+
+	toleranceBps float64
+	legTimeout   time.Duration
+
+	// stale counts the opportunities suppressed for stale quotes
+	stale int
+
+	// executing is set while a cycle or the held residuals are traded off
+	// the tick loop, which keeps consuming ticks in the meantime
+	mu        sync.Mutex
+	executing bool
+	inflight  sync.WaitGroup
+
+	// held are the residuals of broken cycles waiting to be recovered
+	held   []residual
+	events chan RecoveryEvent
+
+	// open are the lifetimes of the open opportunities, by cycle index
+	open   map[int]*OpportunityLifetime
+	closed chan OpportunityLifetime
 }
 
 type BotInput struct {
 	Logger     logrus.FieldLogger
 	MarketData MarketDataProvider
 	Execution  ExecutionProvider
+	Fees       *fees.Model
 	Symbols    []string
+	MaxLegs    int
+
+	// Evaluator decides which opportunities are tradeable, any with a
+	// positive edge after fees and slippage by default.
+	Evaluator Evaluator
+
+	// ExecutionMode is how the best opportunity of a tick is traded, off by
+	// default.
+	ExecutionMode ExecutionMode
+
+	// Recovery decides how to recover what a broken cycle left over.
+	Recovery RecoveryPolicy
+
+	// Journal records every detected opportunity, if set.
+	Journal Journal
+
+	// MaxQuoteAge and MaxQuoteSkew suppress cycles with a quote older than
+	// the max age, or with quotes further apart than the max skew. Zero
+	// disables the check.
+	MaxQuoteAge  time.Duration
+	MaxQuoteSkew time.Duration
+
+	// Books are used to size opportunities by the liquidity deeper in the
+	// books, if set. Otherwise only the top of the book is considered.
+	Books BookProvider
+
+	// SlippageToleranceBps moves the limit of every leg past the worst level
+	// its size takes, so that the leg still fills if the book moves against
+	// it. LegTimeout bounds the wait for a leg to fill, 30 seconds by
+	// default.
+	SlippageToleranceBps float64
+	LegTimeout           time.Duration
+
+	// Anchors are the currencies cycles start and end in, USD by default.
+	// Profits are reported in the anchor and the reporting currency, which
+	// is also the currency of the execution provider's capital.
+	Anchors           []string
+	ReportingCurrency string
 }
 
+// NewTriangleBot creates the bot for the given symbols. Exchange aliases such
+// as XBT are accepted and replaced by their canonical codes. Without symbols,
+// every currency listed on the exchange is considered. Cycles are triangles
+// unless MaxLegs allows longer ones, of up to five legs.
 func NewTriangleBot(input BotInput) *TriangleBot {
+	symbols := canonicalize(input.Logger, input.Symbols)
+
+	anchors := canonicalize(input.Logger, input.Anchors)
+	if len(anchors) == 0 {
+		anchors = []string{defaultAnchor}
+	}
+
+	reporting, err := symbol.Kraken.Canonical(input.ReportingCurrency)
+	if err != nil {
+		reporting = anchors[0]
+	}
+
 	tabot := &TriangleBot{
 		logger:     input.Logger.WithField("comp", "tabot"),
 		marketData: input.MarketData,
 		trader:     input.Execution,
-		symbols:    input.Symbols,
+		books:      input.Books,
+		fees:       input.Fees,
+		evaluator:  input.Evaluator,
+		mode:       input.ExecutionMode,
+		recovery:   input.Recovery,
+		journal:    input.Journal,
+		symbols:    symbols,
+		anchors:    anchors,
+		reporting:  reporting,
+		maxLegs:    input.MaxLegs,
+		normalizer: symbol.NewNormalizer(symbol.KrakenAliases, nil, symbols...),
+
+		maxQuoteAge:  input.MaxQuoteAge,
+		maxQuoteSkew: input.MaxQuoteSkew,
+
+		toleranceBps: input.SlippageToleranceBps,
+		legTimeout:   input.LegTimeout,
+
+		events: make(chan RecoveryEvent, eventBufferSize),
+		open:   make(map[int]*OpportunityLifetime),
+		closed: make(chan OpportunityLifetime, eventBufferSize),
+	}
+
+	if tabot.evaluator == nil {
+		tabot.evaluator = ProfitEvaluator{}
+	}
+
+	if tabot.fees == nil {
+		tabot.fees = fees.NewModel(fees.KrakenTiers, 0)
+	}
+
+	switch tabot.mode {
+	case ExecutionOff, ExecutionSequential, ExecutionParallel:
+	default:
+		tabot.logger.WithError(errors.Wrap(ErrUnknownMode, string(tabot.mode))).Warn("not executing opportunities")
+		tabot.mode = ExecutionOff
+	}
+
+	if tabot.maxLegs < defaultMaxLegs {
+		tabot.maxLegs = defaultMaxLegs
+	}
+
+	if tabot.maxLegs > maxLegsLimit {
+		tabot.logger.WithFields(logrus.Fields{
+			"max_legs": tabot.maxLegs,
+			"limit":    maxLegsLimit,
+		}).Warn("limiting the length of cycles")
+
+		tabot.maxLegs = maxLegsLimit
+	}
+
+	if tabot.legTimeout <= 0 {
+		tabot.legTimeout = defaultLegTimeout
 	}
 
 	return tabot
 }
 
-func (t *TriangleBot) Run(ctx context.Context) {
-	dim := len(t.symbols)
-	exch := mat.NewDense(dim, dim, nil)
+const (
+	// defaultAnchor is the currency cycles start and end in if no anchors
+	// are configured.
+	defaultAnchor = "USD"
+
+	// defaultMaxLegs limits the cycles to triangles.
+	defaultMaxLegs = 3
 
-	// Initialize exchange matrix as identity matrix
-	for i := 0; i < dim; i++ {
-		exch.Set(i, i, 1)
+	// maxLegsLimit caps the length of cycles, as their number grows
+	// exponentially with it.
+	maxLegsLimit = 5
+
+	// maxCycles is how many cycles the bot is willing to rescan on ticks.
+	maxCycles = 50000
+
+	// defaultLegTimeout is how long a leg may take to fill.
+	defaultLegTimeout = 30 * time.Second
+)
+
+var (
+	ErrNoCycles        = errors.New("no cycles found")
+	ErrTooManyCycles   = errors.New("too many cycles")
+	ErrSymbolsRequired = errors.New("symbols required for cycles longer than triangles")
+	ErrUnknownSymbol   = errors.New("unknown symbol")
+)
+
+// Run discovers all cycles through the anchors from the pairs listed on the
+// exchange, subscribes to the pairs they trade and evaluates the cycles of
+// every ticked pair until the market data stream ends. If symbols were
+// configured, only cycles between them are considered, and a symbol that is
+// not part of any cycle fails with ErrUnknownSymbol, as it is most likely a
+// typo. Cycles longer than triangles require symbols, and more cycles than
+// the bot can rescan on every tick fail with ErrTooManyCycles.
+func (t *TriangleBot) Run(ctx context.Context) error {
+	listed, err := t.marketData.Pairs(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error listing pairs")
 	}
 
-	dataStream := t.marketData.Stream(ctx)
+	// Longer cycles through every listed currency are too many to rescan
+	if t.maxLegs > defaultMaxLegs && len(t.symbols) == 0 {
+		return errors.Wrapf(ErrSymbolsRequired, "%d legs", t.maxLegs)
+	}
 
-	// Subscribe to all pairs
-	for idx1 := range t.symbols {
-		for idx2 := idx1 + 1; idx2 < len(t.symbols); idx2++ {
-			ticker := fmt.Sprintf("%s/%s", t.symbols[idx2], t.symbols[idx1])
+	g := discover(listed, t.anchors, t.symbols, t.maxLegs, maxCycles)
+	if len(g.cycles) == 0 {
+		return errors.Wrap(ErrNoCycles, strings.Join(t.anchors, ","))
+	}
 
-			err := t.marketData.Subscribe(ticker)
-			if err != nil {
-				t.logger.WithError(err).Errorf("failed to subscribe to %s", ticker)
-			}
+	if len(g.cycles) > maxCycles {
+		return errors.Wrapf(ErrTooManyCycles, "more than %d cycles of up to %d legs", maxCycles, t.maxLegs)
+	}
+
+	for _, sym := range t.symbols {
+		if _, err := index(sym, g.symbols); err != nil {
+			return errors.Wrapf(ErrUnknownSymbol, "%s is not part of any cycle", sym)
+		}
+	}
+
+	// Profits are converted to the reporting currency at the rate of the
+	// pair between it and the anchor
+	for _, anchor := range t.anchors {
+		if anchor != t.reporting && !g.link(listed, anchor, t.reporting) {
+			t.logger.WithFields(logrus.Fields{
+				"anchor":    anchor,
+				"reporting": t.reporting,
+			}).Warn("no pair to convert profits to the reporting currency")
 		}
 	}
 
+	t.symbols = g.symbols
+	t.normalizer = symbol.NewNormalizer(symbol.KrakenAliases, nil, g.symbols...)
+
+	t.logger.WithFields(logrus.Fields{
+		"anchors":    strings.Join(t.anchors, ","),
+		"currencies": len(g.symbols),
+		"pairs":      len(g.pairs),
+		"cycles":     len(g.cycles),
+		"max_legs":   t.maxLegs,
+	}).Info("discovered cycles")
+
+	d := newDetector(len(t.symbols), g.cycles)
+	d.maxAge, d.maxSkew = t.maxQuoteAge, t.maxQuoteSkew
+
+	// Ticks are consumed while subscribing, so that the first pairs' data
+	// never holds up the subscriptions of the others
+	dataStream := t.marketData.Stream(ctx)
+
+	go t.subscribe(ctx, g)
+
+	// Execution outlives the stream until its context is done
+	defer t.inflight.Wait()
+
 	for tick := range dataStream {
-		instrument, base := parsePair(tick.Symbol)
+		instrument, base, err := parsePair(tick.Symbol, t.normalizer)
+		if err != nil {
+			t.logger.WithError(err).Warn("ignoring tick")
+
+			continue
+		}
+
+		instrumentIdx, err := index(instrument, t.symbols)
+		if err != nil {
+			t.logger.WithError(err).Warn("ignoring tick")
+
+			continue
+		}
+
+		baseIdx, err := index(base, t.symbols)
+		if err != nil {
+			t.logger.WithError(err).Warn("ignoring tick")
+
+			continue
+		}
+
 		t.logger.
 			WithFields(logrus.Fields{
 				"instrument": instrument,
@@ -101,120 +355,295 @@ func (t *TriangleBot) Run(ctx context.Context) {
 		//    1 GBP -> 1/53975.8 BTC (ie 1/ask)
 		//    1 BTC -> 53975.7 GBP (ie bid)
 
-		// Update exchange rates:
-		// - buy instrument, sell base at this rate, exchange matrix upper triangle
-		exch.Set(index(base, t.symbols), index(instrument, t.symbols), 1/tick.Ask)
-
-		// - sell instrument, buy base at this rate, exchange matrix lower triangle
-		exch.Set(index(instrument, t.symbols), index(base, t.symbols), tick.Bid)
-
 		// The convention for the exchange rate matrix is:
 		// you always go from row to column. Matrix element is the respective
-		// exchange rate.
-
-		// Always start at USD
-		leg1Idx := index("USD", t.symbols)
-
-		for leg2Idx := 0; leg2Idx < dim && leg2Idx != leg1Idx; leg2Idx++ {
-			for leg3Idx := 0; leg3Idx < dim && leg2Idx != leg3Idx && leg3Idx != leg1Idx; leg3Idx++ {
-				leg1 := t.symbols[leg1Idx]
-				leg2 := t.symbols[leg2Idx]
-				leg3 := t.symbols[leg3Idx]
-
-				if leg1 != instrument && leg2 != instrument && leg3 != instrument {
-					continue
-				}
-
-				// leg1 -> leg2: buy leg2, sell leg1
-				// leg2 -> leg3: buy leg3, sell leg2
-				leg1Leg2Leg3 := exch.At(leg1Idx, leg2Idx) * exch.At(leg2Idx, leg3Idx)
-
-				// leg3 -> leg1: buy leg1, sell leg3
-				leg3Leg1 := exch.At(leg3Idx, leg1Idx)
-
-				if leg1Leg2Leg3 == 0 || leg3Leg1 == 0 {
-					continue
-				}
-
-				deltaPct := leg1Leg2Leg3 * leg3Leg1 * 100
-
-				if isTradeable(deltaPct) {
-					// TODO: Execute trades, make it look nicer
-
-					//// Leg1
-					//err := t.trader.Execute(ctx, ExecutionInput{
-					//	Symbol: leg2,
-					//	Base:   leg1,
-					//	Side:   "sell",
-					//	Rate:   1 / exch.At(leg2Idx, leg1Idx),
-					//})
-					//if err != nil {
-					//	t.logger.WithFields(logrus.Fields{
-					//		"leg1": leg1,
-					//	}).WithError(err).Error("failed to execute trade")
-					//}
-					//// Leg2
-					//err = t.trader.Execute(ctx, ExecutionInput{
-					//	Symbol: leg3,
-					//	Base:   leg2,
-					//	Side:   "sell",
-					//	Rate:   1 / exch.At(leg3Idx, leg2Idx),
-					//})
-					//if err != nil {
-					//	t.logger.WithFields(logrus.Fields{
-					//		"leg2": leg2,
-					//	}).WithError(err).Error("failed to execute trade")
-					//}
-					//
-					//// Leg3
-					//err = t.trader.Execute(ctx, ExecutionInput{
-					//	Symbol: leg3,
-					//	Base:   leg1,
-					//	Side:   "buy",
-					//	Rate:   1 / exch.At(leg3Idx, leg1Idx),
-					//})
-					//if err != nil {
-					//	t.logger.WithFields(logrus.Fields{
-					//		"leg3": leg3,
-					//	}).WithError(err).Error("failed to execute trade")
-					//}
-
-					t.logger.WithFields(logrus.Fields{
-						"leg1": leg1,
-						"leg2": leg2,
-						"leg3": leg3,
-						// "leg1Leg2Leg3": fmt.Sprintf("%.4f", capital*leg1Leg2Leg3),
-						//"leg3Leg1":     fmt.Sprintf("%.4f", capital*(1/leg3Leg1)),
-						"delta_pct": fmt.Sprintf("%.2f", deltaPct-100),
-						//	"capital_usd":  fmt.Sprintf("%.4f", t.trader.TotalCapital()),
-					}).Infof("calculated rates for %s/%s/%s", leg1, leg2, leg3)
-				}
-			}
-		}
-	}
-}
-
-func isTradeable(delta float64) bool {
-	// TODO: Implement triangular arbitrage opportunity detection
-
-	return delta > 100.2
-}
-
-func index(symbol string, syms []string) int {
+		// exchange rate. As both directions are set from the pair, it does
+		// not matter which way round the exchange lists it.
+
+		at := tick.Time
+		if at.IsZero() {
+			at = time.Now()
+		}
+
+		// Update exchange rates, with the amount of the currency sold the
+		// top of the book takes:
+		// - buy instrument, sell base at this rate
+		affected := d.update(baseIdx, instrumentIdx, 1/tick.Ask, tick.AskQty*tick.Ask, at)
+
+		// - sell instrument, buy base at this rate
+		affected = append(affected, d.update(instrumentIdx, baseIdx, tick.Bid, tick.BidQty, at)...)
+
+		t.evaluate(ctx, g, d, affected, at)
+	}
+
+	return nil
+}
+
+// evaluate reports the tradeable cycles among the ones affected by a tick,
+// the highest net edge first, and executes the best one off the tick loop
+// unless execution is off or another trade is still in flight. Cycles with
+// stale quotes at the time of the tick are suppressed.
+func (t *TriangleBot) evaluate(ctx context.Context, g graph, d *detector, affected []int, now time.Time) {
+	var opportunities []Opportunity
+
+	suppressed := 0
+
+	for _, idx := range d.rank(affected) {
+		c := g.cycles[idx]
+
+		// Simulated and market orders always take liquidity
+		legFees := make([]float64, 0, len(c))
+		for _, leg := range c.legs() {
+			legFees = append(legFees, t.fees.Taker(g.pair(leg)))
+		}
+
+		opportunity := t.opportunity(g, d, idx, legFees)
+
+		switch {
+		case d.stale(idx, now):
+			suppressed++
+
+			t.record(g, d, opportunity, now, SkipStale, nil)
+		case !t.evaluator.Tradeable(opportunity):
+			t.record(g, d, opportunity, now, SkipNotTradeable, nil)
+		default:
+			opportunities = append(opportunities, opportunity)
+		}
+	}
+
+	if suppressed > 0 {
+		t.stale += suppressed
+
+		t.logger.WithFields(logrus.Fields{
+			"suppressed": suppressed,
+			"total":      t.stale,
+		}).Info("suppressed opportunities with stale quotes")
+	}
+
+	sort.SliceStable(opportunities, func(i, j int) bool {
+		return opportunities[i].EdgeBps > opportunities[j].EdgeBps
+	})
+
+	opened := t.track(d, affected, opportunities, now)
+
+	// Open opportunities are only reported again at debug level
+	for idx, opportunity := range opportunities {
+		logger := t.logger.WithFields(logrus.Fields{
+			"cycle":            opportunity.Cycle,
+			"legs":             opportunity.Legs,
+			"rank":             idx + 1,
+			"anchor":           opportunity.Anchor,
+			"delta_pct":        fmt.Sprintf("%.2f", (opportunity.Rate-1)*100),
+			"net_pct":          fmt.Sprintf("%.2f", (opportunity.NetRate-1)*100),
+			"edge_bps":         fmt.Sprintf("%.1f", opportunity.EdgeBps),
+			"slippage_bps":     fmt.Sprintf("%.1f", opportunity.SlippageBps),
+			"max_notional":     fmt.Sprintf("%.4f", opportunity.MaxNotional),
+			"notional":         fmt.Sprintf("%.4f", opportunity.Notional),
+			"profit":           fmt.Sprintf("%.4f", opportunity.Profit),
+			"reporting":        opportunity.Reporting,
+			"profit_reporting": fmt.Sprintf("%.4f", opportunity.ProfitReporting),
+		})
+
+		if opened[opportunity.idx] {
+			logger.Info("opportunity opened")
+		} else {
+			logger.Debug("opportunity open")
+		}
+	}
+
+	if t.mode == ExecutionOff {
+		for _, opportunity := range opportunities {
+			t.record(g, d, opportunity, now, SkipExecutionOff, nil)
+		}
+
+		return
+	}
+
+	// Cycles compete for the same capital, so nothing is traded while
+	// another trade is in flight
+	if !t.acquire() {
+		for _, opportunity := range opportunities {
+			t.record(g, d, opportunity, now, SkipInFlight, nil)
+		}
+
+		return
+	}
+
+	var best *Opportunity
+
+	if len(opportunities) > 0 {
+		// Only the best one is traded
+		for _, opportunity := range opportunities[1:] {
+			t.record(g, d, opportunity, now, SkipOutranked, nil)
+		}
+
+		if opportunities[0].Notional > 0 {
+			best = &opportunities[0]
+		} else {
+			t.record(g, d, opportunities[0], now, SkipNoCapital, nil)
+		}
+	}
+
+	if best == nil && len(t.held) == 0 {
+		t.release()
+
+		return
+	}
+
+	if best != nil {
+		if lifetime, ok := t.open[best.idx]; ok {
+			lifetime.Executed = true
+		}
+	}
+
+	// The legs are priced at the rates the opportunity was evaluated at
+	snapshot := d.snapshot()
+
+	t.inflight.Add(1)
+
+	go func() {
+		defer t.inflight.Done()
+		defer t.release()
+
+		t.tradeBest(ctx, g, d, snapshot, best, now)
+	}()
+}
+
+// tradeBest recovers the held residuals and executes the opportunity, if any,
+// off the tick loop. Legs are priced from the snapshot of the detector, what
+// the cycle leaves over is recovered at the rates after it.
+func (t *TriangleBot) tradeBest(ctx context.Context, g graph, d, snapshot *detector, best *Opportunity, now time.Time) {
+	t.recoverHeld(ctx, g, snapshot)
+
+	if best == nil {
+		return
+	}
+
+	result := t.execute(ctx, g, snapshot, *best)
+	t.report(result)
+
+	t.record(g, snapshot, *best, now, "", &result)
+
+	after := d.snapshot()
+	for _, r := range t.residuals(g, *best, result) {
+		t.recover(ctx, g, after, r, false)
+	}
+}
+
+// acquire reports whether nothing is being traded, marking the bot as
+// trading if so.
+func (t *TriangleBot) acquire() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.executing {
+		return false
+	}
+
+	t.executing = true
+
+	return true
+}
+
+// release marks the bot as no longer trading.
+func (t *TriangleBot) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.executing = false
+}
+
+// subscribe subscribes to the ticker and book of every pair the cycles trade.
+func (t *TriangleBot) subscribe(ctx context.Context, g graph) {
+	for _, ticker := range g.subscriptions() {
+		err := t.marketData.Subscribe(ctx, ticker)
+		if err != nil {
+			// The cycles trading the pair never complete
+			t.logger.WithError(err).Warnf("failed to subscribe to %s", ticker)
+		}
+
+		if t.books == nil {
+			continue
+		}
+
+		err = t.books.SubscribeBook(ctx, ticker)
+		if err != nil {
+			// Sizing falls back to the top of the book
+			t.logger.WithError(err).Warnf("failed to subscribe to %s book", ticker)
+		}
+	}
+}
+
+// report logs the result of executing a cycle.
+func (t *TriangleBot) report(result CycleResult) {
+	for _, leg := range result.Legs {
+		t.logger.WithFields(logrus.Fields{
+			"cycle":         result.Cycle,
+			"pair":          leg.Pair,
+			"side":          leg.Side,
+			"qty":           leg.Qty,
+			"filled":        leg.Filled,
+			"expected_rate": leg.ExpectedRate,
+			"realized_rate": leg.RealizedRate,
+			"fee":           leg.Fee,
+			"fee_asset":     leg.FeeAsset,
+		}).WithError(leg.Err).Info("executed leg")
+	}
+
+	logger := t.logger.WithFields(logrus.Fields{
+		"cycle":           result.Cycle,
+		"anchor":          result.Anchor,
+		"mode":            result.Mode,
+		"legs":            len(result.Legs),
+		"notional":        fmt.Sprintf("%.4f", result.Notional),
+		"expected_profit": fmt.Sprintf("%.4f", result.ExpectedProfit),
+		"fees":            fmt.Sprintf("%.4f", result.Fees),
+		"net_pnl":         fmt.Sprintf("%.4f", result.NetPnL),
+	})
+
+	if result.Err != nil {
+		logger.WithError(result.Err).Warn("failed to execute cycle")
+
+		return
+	}
+
+	logger.Info("executed cycle")
+}
+
+func index(symbol string, syms []string) (int, error) {
 	for i, s := range syms {
 		if s == symbol {
-			return i
+			return i, nil
 		}
 	}
 
-	return -1
+	return 0, errors.Wrap(ErrUnknownSymbol, symbol)
 }
 
-func parsePair(pair string) (string, string) {
-	tickers := strings.Split(pair, "/")
-	if len(tickers) != 2 {
-		return "", ""
+// canonicalize returns the canonical codes of the symbols, skipping empty and
+// invalid ones.
+func canonicalize(logger logrus.FieldLogger, symbols []string) []string {
+	canonical := make([]string, 0, len(symbols))
+
+	for _, sym := range symbols {
+		if strings.TrimSpace(sym) == "" {
+			continue
+		}
+
+		code, err := symbol.Kraken.Canonical(sym)
+		if err != nil {
+			logger.WithError(err).Warn("ignoring symbol")
+
+			continue
+		}
+
+		canonical = append(canonical, code)
 	}
 
-	return tickers[0], tickers[1]
+	return canonical
+}
+
+// parsePair returns the canonical instrument and base of an exchange pair.
+func parsePair(pair string, normalizer *symbol.Normalizer) (string, string, error) {
+	return normalizer.Pair(pair)
 }
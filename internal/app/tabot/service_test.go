@@ -1,25 +1,139 @@
 package tabot
 
-import "testing"
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/peetermeos/tabot/internal/pkg/symbol"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// listing lists fixed pairs and ends its stream right away.
+type listing []Pair
+
+func (l listing) Stream(context.Context) <-chan Tick {
+	ticks := make(chan Tick)
+	close(ticks)
+
+	return ticks
+}
+
+func (l listing) Subscribe(context.Context, string) error {
+	return nil
+}
+
+func (l listing) Unsubscribe(context.Context, string) error {
+	return nil
+}
+
+func (l listing) Pairs(context.Context) ([]Pair, error) {
+	return l, nil
+}
+
+func TestTriangleBot_Run_symbols(t *testing.T) {
+	listed := listing{
+		{"BTC/USD", "BTC", "USD"},
+		{"ETH/USD", "ETH", "USD"},
+		{"ETH/BTC", "ETH", "BTC"},
+		{"SOL/BTC", "SOL", "BTC"},
+	}
+
+	tests := []struct {
+		name    string
+		symbols []string
+		maxLegs int
+		wantErr error
+	}{
+		{"All part of a cycle", []string{"USD", "XBT", "ETH"}, 0, nil},
+		{"Typo", []string{"USD", "BTC", "ETH", "ETX"}, 0, ErrUnknownSymbol},
+		{"Not part of any cycle", []string{"USD", "BTC", "ETH", "SOL"}, 0, ErrUnknownSymbol},
+		{"All currencies", nil, 3, nil},
+		{"Longer cycles of all currencies", nil, 4, ErrSymbolsRequired},
+		{"Longer cycles", []string{"USD", "BTC", "ETH"}, 4, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := NewTriangleBot(BotInput{
+				Logger:     logrus.New(),
+				MarketData: listed,
+				Symbols:    tt.symbols,
+				MaxLegs:    tt.maxLegs,
+			})
+
+			if err := bot.Run(context.Background()); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTriangleBot_Run_tooManyCycles(t *testing.T) {
+	// Every pair of 20 currencies is listed
+	var (
+		listed  listing
+		symbols []string
+	)
+
+	for i := 0; i < 20; i++ {
+		symbols = append(symbols, fmt.Sprintf("C%02d", i))
+	}
+
+	symbols[0] = "USD"
+
+	for i, base := range symbols {
+		for _, quote := range symbols[i+1:] {
+			listed = append(listed, Pair{Symbol: base + "/" + quote, Base: base, Quote: quote})
+		}
+	}
+
+	bot := NewTriangleBot(BotInput{
+		Logger:     logrus.New(),
+		MarketData: listed,
+		Symbols:    symbols,
+		MaxLegs:    8,
+	})
+
+	if bot.maxLegs != maxLegsLimit {
+		t.Errorf("NewTriangleBot() max legs = %d, want %d", bot.maxLegs, maxLegsLimit)
+	}
+
+	if err := bot.Run(context.Background()); !errors.Is(err, ErrTooManyCycles) {
+		t.Errorf("Run() error = %v, want %v", err, ErrTooManyCycles)
+	}
+}
 
 func Test_parsePair(t *testing.T) {
 	type args struct {
 		pair string
 	}
 
+	normalizer := symbol.NewNormalizer(symbol.KrakenAliases, nil, "USD", "BTC", "ETH", "DOGE")
+
 	tests := []struct {
-		name  string
-		args  args
-		want  string
-		want1 string
+		name    string
+		args    args
+		want    string
+		want1   string
+		wantErr error
 	}{
-		{"BTC/USD", args{"BTC/USD"}, "BTC", "USD"},
-		{"ETHBTC", args{"ETHBTC"}, "", ""},
+		{"BTC/USD", args{"BTC/USD"}, "BTC", "USD", nil},
+		{"XBT/USD", args{"XBT/USD"}, "BTC", "USD", nil},
+		{"XDG/USD", args{"XDG/USD"}, "DOGE", "USD", nil},
+		{"XXBTZUSD", args{"XXBTZUSD"}, "BTC", "USD", nil},
+		{"ETHBTC", args{"ETHBTC"}, "ETH", "BTC", nil},
+		{"SOL/USD", args{"SOL/USD"}, "", "", symbol.ErrUnknownAsset},
+		{"BTCUSDT", args{"BTCUSDT"}, "", "", symbol.ErrUnknownAsset},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, got1 := parsePair(tt.args.pair)
+			got, got1, err := parsePair(tt.args.pair, normalizer)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parsePair() error = %v, want %v", err, tt.wantErr)
+			}
 
 			if got != tt.want {
 				t.Errorf("parsePair() got = %v, want %v", got, tt.want)
@@ -39,17 +153,24 @@ func Test_index(t *testing.T) {
 	}
 
 	tests := []struct {
-		name string
-		args args
-		want int
+		name    string
+		args    args
+		want    int
+		wantErr error
 	}{
-		{"BTC", args{"BTC", []string{"BTC", "ETH", "SOL"}}, 0},
-		{"ETH", args{"ETH", []string{"BTC", "ETH", "SOL"}}, 1},
+		{"BTC", args{"BTC", []string{"BTC", "ETH", "SOL"}}, 0, nil},
+		{"ETH", args{"ETH", []string{"BTC", "ETH", "SOL"}}, 1, nil},
+		{"USD", args{"USD", []string{"BTC", "ETH", "SOL"}}, 0, ErrUnknownSymbol},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := index(tt.args.symbol, tt.args.syms); got != tt.want {
+			got, err := index(tt.args.symbol, tt.args.syms)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("index() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
 				t.Errorf("index() = %v, want %v", got, tt.want)
 			}
 		})
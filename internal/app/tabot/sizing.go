@@ -0,0 +1,167 @@
+package tabot
+
+import (
+	"context"
+	"math"
+
+	"github.com/peetermeos/tabot/internal/pkg/orderbook"
+)
+
+// BookProvider provides L2 order books to size opportunities beyond the top of
+// the book.
+type BookProvider interface {
+	SubscribeBook(ctx context.Context, symbol string) error
+	OrderBook(symbol string) (*orderbook.Book, bool)
+}
+
+// step is a price level of a leg. Rate converts the input currency of the
+// leg to its output currency, fees included, and capacity is the amount of
+// the input currency the level takes.
+type step struct {
+	rate     float64
+	capacity float64
+}
+
+// ladder is the liquidity of a leg, the best rate first.
+type ladder []step
+
+// bookLadder returns the ladder of converting from the base to the quote of a
+// pair by selling into the bids, or the other way round by buying from the
+// asks.
+func bookLadder(book *orderbook.Book, sell bool, fee float64) ladder {
+	if sell {
+		levels := book.Bids()
+		l := make(ladder, 0, len(levels))
+
+		for _, level := range levels {
+			l = append(l, step{rate: level.Price * (1 - fee), capacity: level.Volume})
+		}
+
+		return l
+	}
+
+	levels := book.Asks()
+	l := make(ladder, 0, len(levels))
+
+	for _, level := range levels {
+		l = append(l, step{rate: (1 - fee) / level.Price, capacity: level.Volume * level.Price})
+	}
+
+	return l
+}
+
+// convert returns the output for the input, as far as the ladder can take it.
+func (l ladder) convert(in float64) float64 {
+	out := 0.0
+
+	for _, s := range l {
+		if in <= 0 {
+			break
+		}
+
+		filled := math.Min(in, s.capacity)
+		out += filled * s.rate
+		in -= filled
+	}
+
+	return out
+}
+
+// walk returns the average rate of converting the input through the ladder
+// and the rate of the worst level it reaches, zero if it reaches none.
+func (l ladder) walk(in float64) (float64, float64) {
+	var out, used, worst float64
+
+	for _, s := range l {
+		if in <= 0 {
+			break
+		}
+
+		filled := math.Min(in, s.capacity)
+		if filled <= 0 {
+			continue
+		}
+
+		out += filled * s.rate
+		used += filled
+		in -= filled
+		worst = s.rate
+	}
+
+	if used <= 0 {
+		return 0, 0
+	}
+
+	return out / used, worst
+}
+
+// invert returns the input needed for the output, infinite if it exceeds the
+// capacity of the ladder.
+func (l ladder) invert(out float64) float64 {
+	in := 0.0
+
+	for _, s := range l {
+		produced := s.capacity * s.rate
+		if out <= produced {
+			return in + out/s.rate
+		}
+
+		in += s.capacity
+		out -= produced
+	}
+
+	return math.Inf(1)
+}
+
+// breakpoints returns the inputs at which the ladder moves to the next level.
+func (l ladder) breakpoints() []float64 {
+	points := make([]float64, 0, len(l))
+	total := 0.0
+
+	for _, s := range l {
+		total += s.capacity
+		points = append(points, total)
+	}
+
+	return points
+}
+
+// profit returns the profit of trading the notional through the ladders.
+func profit(ladders []ladder, notional float64) float64 {
+	amount := notional
+
+	for _, l := range ladders {
+		amount = l.convert(amount)
+	}
+
+	return amount - notional
+}
+
+// size returns the notional maximizing the profit of trading through the
+// ladders, and that profit. Rates only get worse deeper in the books, so the
+// profit is concave in the notional and peaks at a point where one of the
+// legs moves to its next level. Each such point is mapped back through the
+// preceding legs to the notional that reaches it.
+func size(ladders []ladder) (float64, float64) {
+	var bestNotional, bestProfit float64
+
+	for idx, l := range ladders {
+		for _, point := range l.breakpoints() {
+			notional := point
+
+			for prev := idx - 1; prev >= 0; prev-- {
+				notional = ladders[prev].invert(notional)
+			}
+
+			if math.IsInf(notional, 1) {
+				continue
+			}
+
+			if p := profit(ladders, notional); p > bestProfit {
+				bestNotional, bestProfit = notional, p
+			}
+		}
+	}
+
+	return bestNotional, bestProfit
+}
@@ -0,0 +1,90 @@
+package tabot
+
+import (
+	"math"
+	"testing"
+
+	"github.com/peetermeos/tabot/internal/pkg/orderbook"
+)
+
+func Test_ladder(t *testing.T) {
+	l := ladder{{rate: 2, capacity: 10}, {rate: 1, capacity: 5}}
+
+	tests := []struct {
+		name string
+		in   float64
+		out  float64
+	}{
+		{"First level", 4, 8},
+		{"Second level", 12, 22},
+		{"Beyond capacity", 20, 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := l.convert(tt.in); got != tt.out {
+				t.Errorf("convert() = %v, want %v", got, tt.out)
+			}
+
+			if tt.in <= 15 {
+				if got := l.invert(tt.out); math.Abs(got-tt.in) > 1e-9 {
+					t.Errorf("invert() = %v, want %v", got, tt.in)
+				}
+			}
+		})
+	}
+
+	if got := l.invert(26); !math.IsInf(got, 1) {
+		t.Errorf("invert() beyond capacity = %v, want +Inf", got)
+	}
+
+	if average, worst := l.walk(12); math.Abs(average-22.0/12) > 1e-12 || worst != 1 {
+		t.Errorf("walk() = %v, %v, want %v, 1", average, worst, 22.0/12)
+	}
+
+	if average, worst := l.walk(0); average != 0 || worst != 0 {
+		t.Errorf("walk() of nothing = %v, %v, want 0, 0", average, worst)
+	}
+}
+
+func Test_bookLadder(t *testing.T) {
+	book := orderbook.New("BTC/USD", 10)
+	book.ApplySnapshot(
+		[]orderbook.Level{{Price: 50000, Volume: 1}, {Price: 49900, Volume: 2}},
+		[]orderbook.Level{{Price: 50100, Volume: 0.5}},
+	)
+
+	sell := bookLadder(book, true, 0)
+	if got := sell.convert(2); got != 50000+49900 {
+		t.Errorf("selling 2 BTC = %v USD, want %v", got, 50000+49900)
+	}
+
+	buy := bookLadder(book, false, 0)
+	if got := buy.convert(50100 * 0.5); math.Abs(got-0.5) > 1e-12 {
+		t.Errorf("buying for 25050 USD = %v BTC, want 0.5", got)
+	}
+}
+
+func Test_size(t *testing.T) {
+	// USD -> BTC -> ETH -> USD, where the ETH -> USD bids get worse with size
+	ladders := []ladder{
+		{{rate: 1.0 / 50000, capacity: 1e6}},
+		{{rate: 20, capacity: 100}},
+		{{rate: 2550, capacity: 1}, {rate: 2510, capacity: 1}, {rate: 2490, capacity: 10}},
+	}
+
+	notional, profit := size(ladders)
+
+	// The second ETH level still returns 0.4%, the third loses money
+	if math.Abs(notional-5000) > 1e-6 {
+		t.Errorf("size() notional = %v, want 5000", notional)
+	}
+
+	if want := 2550 + 2510 - 5000.0; math.Abs(profit-want) > 1e-6 {
+		t.Errorf("size() profit = %v, want %v", profit, want)
+	}
+
+	if notional, profit := size([]ladder{{{rate: 0.99, capacity: 10}}}); notional != 0 || profit != 0 {
+		t.Errorf("size() of a losing ladder = %v, %v", notional, profit)
+	}
+}
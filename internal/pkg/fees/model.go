@@ -0,0 +1,140 @@
+package fees
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Rates are the maker and taker fees as fractions of the traded notional.
+type Rates struct {
+	Maker float64
+	Taker float64
+}
+
+// Tier is a fee tier that applies from the given 30 day volume in USD.
+type Tier struct {
+	Volume float64
+	Rates
+}
+
+// KrakenTiers is the Kraken spot fee schedule.
+var KrakenTiers = []Tier{
+	{0, Rates{Maker: 0.0025, Taker: 0.0040}},
+	{10_001, Rates{Maker: 0.0020, Taker: 0.0035}},
+	{50_001, Rates{Maker: 0.0014, Taker: 0.0024}},
+	{100_001, Rates{Maker: 0.0012, Taker: 0.0022}},
+	{250_001, Rates{Maker: 0.0010, Taker: 0.0020}},
+	{500_001, Rates{Maker: 0.0008, Taker: 0.0018}},
+	{1_000_001, Rates{Maker: 0.0006, Taker: 0.0016}},
+	{2_500_001, Rates{Maker: 0.0004, Taker: 0.0014}},
+	{5_000_001, Rates{Maker: 0.0002, Taker: 0.0012}},
+	{10_000_001, Rates{Maker: 0.0000, Taker: 0.0010}},
+}
+
+// ScheduleProvider reports the account's 30 day volume and the fees the
+// exchange charges per pair.
+type ScheduleProvider interface {
+	FeeSchedule(ctx context.Context, pairs ...string) (float64, map[string]Rates, error)
+}
+
+// Model knows the maker and taker fees of every pair. Fees come from the tier
+// of the 30 day volume, unless the exchange reported fees for the pair.
+type Model struct {
+	mu     sync.RWMutex
+	tiers  []Tier
+	volume float64
+	pairs  map[string]Rates
+}
+
+// NewModel creates a fee model with the given tiers for the given 30 day
+// volume in USD.
+func NewModel(tiers []Tier, volume float64) *Model {
+	sorted := make([]Tier, len(tiers))
+	copy(sorted, tiers)
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Volume < sorted[j].Volume })
+
+	return &Model{
+		tiers:  sorted,
+		volume: volume,
+		pairs:  make(map[string]Rates),
+	}
+}
+
+// Refresh updates the volume and the pair fees from the exchange.
+func (m *Model) Refresh(ctx context.Context, provider ScheduleProvider, pairs ...string) error {
+	volume, rates, err := provider.FeeSchedule(ctx, pairs...)
+	if err != nil {
+		return errors.Wrap(err, "error fetching fee schedule")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.volume = volume
+
+	for pair, rate := range rates {
+		m.pairs[pair] = rate
+	}
+
+	return nil
+}
+
+// SetVolume sets the 30 day volume used to pick the tier.
+func (m *Model) SetVolume(volume float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.volume = volume
+}
+
+// SetPairRates overrides the fees of a single pair.
+func (m *Model) SetPairRates(pair string, rates Rates) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pairs[pair] = rates
+}
+
+// Volume returns the 30 day volume used to pick the tier.
+func (m *Model) Volume() float64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.volume
+}
+
+// Rates returns the fees of the pair.
+func (m *Model) Rates(pair string) Rates {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if rates, ok := m.pairs[pair]; ok {
+		return rates
+	}
+
+	return m.tier().Rates
+}
+
+// Maker returns the maker fee of the pair.
+func (m *Model) Maker(pair string) float64 {
+	return m.Rates(pair).Maker
+}
+
+// Taker returns the taker fee of the pair.
+func (m *Model) Taker(pair string) float64 {
+	return m.Rates(pair).Taker
+}
+
+// tier returns the tier of the current volume. The caller must hold m.mu.
+func (m *Model) tier() Tier {
+	idx := sort.Search(len(m.tiers), func(i int) bool { return m.tiers[i].Volume > m.volume })
+	if idx == 0 {
+		return Tier{}
+	}
+
+	return m.tiers[idx-1]
+}
@@ -0,0 +1,55 @@
+package fees
+
+import (
+	"context"
+	"testing"
+)
+
+type staticSchedule struct {
+	volume float64
+	rates  map[string]Rates
+}
+
+func (s staticSchedule) FeeSchedule(_ context.Context, _ ...string) (float64, map[string]Rates, error) {
+	return s.volume, s.rates, nil
+}
+
+func TestModel_Rates(t *testing.T) {
+	tests := []struct {
+		name   string
+		volume float64
+		want   Rates
+	}{
+		{"Lowest tier", 0, Rates{Maker: 0.0025, Taker: 0.0040}},
+		{"Within tier", 75_000, Rates{Maker: 0.0014, Taker: 0.0024}},
+		{"Top tier", 50_000_000, Rates{Maker: 0, Taker: 0.0010}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewModel(KrakenTiers, tt.volume).Rates("BTC/USD"); got != tt.want {
+				t.Errorf("Rates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModel_Refresh(t *testing.T) {
+	m := NewModel(KrakenTiers, 0)
+
+	err := m.Refresh(context.Background(), staticSchedule{
+		volume: 300_000,
+		rates:  map[string]Rates{"USDT/USD": {Maker: 0, Taker: 0.0005}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := m.Taker("BTC/USD"); got != 0.0020 {
+		t.Errorf("Taker(BTC/USD) = %v, want 0.0020", got)
+	}
+
+	if got := m.Taker("USDT/USD"); got != 0.0005 {
+		t.Errorf("Taker(USDT/USD) = %v, want 0.0005", got)
+	}
+}
@@ -0,0 +1,181 @@
+package instrument
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrUnknownPair   = errors.New("unknown pair")
+	ErrBelowMinimum  = errors.New("order below minimum")
+	ErrInvalidAmount = errors.New("invalid amount")
+)
+
+// Pair is the trading metadata of a currency pair.
+type Pair struct {
+	Symbol string
+	Base   string
+	Quote  string
+	Status string
+
+	PricePrecision int
+	PriceIncrement float64
+	QtyPrecision   int
+	QtyIncrement   float64
+
+	// QtyMin is the minimum order size in the base currency, CostMin the
+	// minimum order value in the quote currency.
+	QtyMin  float64
+	CostMin float64
+}
+
+// RoundPrice rounds the price to the nearest price increment.
+func (p Pair) RoundPrice(price float64) float64 {
+	step := increment(p.PriceIncrement, p.PricePrecision)
+
+	return round(math.Round(price/step)*step, p.PricePrecision)
+}
+
+// FloorPrice rounds the price down to the price increment, so that a sell
+// limit never asks for more than it was priced at.
+func (p Pair) FloorPrice(price float64) float64 {
+	step := increment(p.PriceIncrement, p.PricePrecision)
+
+	return round(math.Floor(price/step+1e-9)*step, p.PricePrecision)
+}
+
+// CeilPrice rounds the price up to the price increment, so that a buy limit
+// never bids less than it was priced at.
+func (p Pair) CeilPrice(price float64) float64 {
+	step := increment(p.PriceIncrement, p.PricePrecision)
+
+	return round(math.Ceil(price/step-1e-9)*step, p.PricePrecision)
+}
+
+// RoundQty rounds the quantity down to the quantity increment, so that an
+// order never exceeds the quantity it was sized for.
+func (p Pair) RoundQty(qty float64) float64 {
+	step := increment(p.QtyIncrement, p.QtyPrecision)
+
+	// The epsilon keeps quantities already on the increment from being
+	// floored to the one below by floating point error
+	return round(math.Floor(qty/step+1e-9)*step, p.QtyPrecision)
+}
+
+// Validate checks the order quantity and price against the pair minimums.
+// The cost minimum is not checked if the price is not known, as for market
+// orders.
+func (p Pair) Validate(qty, price float64) error {
+	if qty <= 0 || price < 0 {
+		return errors.Wrapf(ErrInvalidAmount, "%s qty %v price %v", p.Symbol, qty, price)
+	}
+
+	if qty < p.QtyMin {
+		return errors.Wrapf(ErrBelowMinimum, "%s qty %v < %v", p.Symbol, qty, p.QtyMin)
+	}
+
+	if price > 0 && qty*price < p.CostMin {
+		return errors.Wrapf(ErrBelowMinimum, "%s cost %v < %v", p.Symbol, qty*price, p.CostMin)
+	}
+
+	return nil
+}
+
+// Registry holds the metadata of all known pairs.
+type Registry struct {
+	mu    sync.RWMutex
+	pairs map[string]Pair
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		pairs: make(map[string]Pair),
+	}
+}
+
+// Set adds or replaces the metadata of the given pairs.
+func (r *Registry) Set(pairs ...Pair) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, pair := range pairs {
+		r.pairs[pair.Symbol] = pair
+	}
+}
+
+// Get returns the metadata of the pair.
+func (r *Registry) Get(symbol string) (Pair, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pair, ok := r.pairs[symbol]
+
+	return pair, ok
+}
+
+// Pairs returns the metadata of all known pairs, ordered by symbol.
+func (r *Registry) Pairs() []Pair {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pairs := make([]Pair, 0, len(r.pairs))
+
+	for _, pair := range r.pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Symbol < pairs[j].Symbol })
+
+	return pairs
+}
+
+// RoundPrice rounds the price to the price increment of the pair.
+func (r *Registry) RoundPrice(symbol string, price float64) (float64, error) {
+	pair, ok := r.Get(symbol)
+	if !ok {
+		return 0, errors.Wrap(ErrUnknownPair, symbol)
+	}
+
+	return pair.RoundPrice(price), nil
+}
+
+// RoundQty rounds the quantity down to the quantity increment of the pair.
+func (r *Registry) RoundQty(symbol string, qty float64) (float64, error) {
+	pair, ok := r.Get(symbol)
+	if !ok {
+		return 0, errors.Wrap(ErrUnknownPair, symbol)
+	}
+
+	return pair.RoundQty(qty), nil
+}
+
+// Validate checks the order quantity and price against the minimums of the
+// pair.
+func (r *Registry) Validate(symbol string, qty, price float64) error {
+	pair, ok := r.Get(symbol)
+	if !ok {
+		return errors.Wrap(ErrUnknownPair, symbol)
+	}
+
+	return pair.Validate(qty, price)
+}
+
+// increment returns the increment, falling back to the smallest step the
+// precision allows.
+func increment(increment float64, precision int) float64 {
+	if increment > 0 {
+		return increment
+	}
+
+	return math.Pow10(-precision)
+}
+
+// round drops the floating point noise beyond the precision.
+func round(value float64, precision int) float64 {
+	scale := math.Pow10(precision)
+
+	return math.Round(value*scale) / scale
+}
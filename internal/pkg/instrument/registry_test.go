@@ -0,0 +1,125 @@
+package instrument
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+var btcUSD = Pair{
+	Symbol:         "BTC/USD",
+	PricePrecision: 1,
+	PriceIncrement: 0.1,
+	QtyPrecision:   8,
+	QtyIncrement:   0.00000001,
+	QtyMin:         0.0001,
+	CostMin:        0.5,
+}
+
+func TestPair_RoundPrice(t *testing.T) {
+	tests := []struct {
+		name  string
+		pair  Pair
+		price float64
+		want  float64
+	}{
+		{"On increment", btcUSD, 60000.1, 60000.1},
+		{"Rounded up", btcUSD, 60000.16, 60000.2},
+		{"Rounded down", btcUSD, 60000.14, 60000.1},
+		{"Coarse increment", Pair{PricePrecision: 2, PriceIncrement: 0.05}, 1.2345, 1.25},
+		{"Precision only", Pair{PricePrecision: 3}, 1.23456, 1.235},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pair.RoundPrice(tt.price); got != tt.want {
+				t.Errorf("RoundPrice() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPair_FloorPrice_CeilPrice(t *testing.T) {
+	tests := []struct {
+		name      string
+		pair      Pair
+		price     float64
+		wantFloor float64
+		wantCeil  float64
+	}{
+		{"On increment", btcUSD, 60000.1, 60000.1, 60000.1},
+		{"Above the middle", btcUSD, 60000.16, 60000.1, 60000.2},
+		{"Below the middle", btcUSD, 60000.14, 60000.1, 60000.2},
+		{"Coarse increment", Pair{PricePrecision: 2, PriceIncrement: 0.05}, 1.2345, 1.2, 1.25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pair.FloorPrice(tt.price); got != tt.wantFloor {
+				t.Errorf("FloorPrice() = %v, want %v", got, tt.wantFloor)
+			}
+
+			if got := tt.pair.CeilPrice(tt.price); got != tt.wantCeil {
+				t.Errorf("CeilPrice() = %v, want %v", got, tt.wantCeil)
+			}
+		})
+	}
+}
+
+func TestPair_RoundQty(t *testing.T) {
+	tests := []struct {
+		name string
+		pair Pair
+		qty  float64
+		want float64
+	}{
+		{"On increment", btcUSD, 0.12345678, 0.12345678},
+		{"Rounded down", btcUSD, 0.123456789, 0.12345678},
+		{"Floating point error", Pair{QtyPrecision: 1, QtyIncrement: 0.1}, 0.3, 0.3},
+		{"Whole units", Pair{QtyPrecision: 0, QtyIncrement: 1}, 12.9, 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pair.RoundQty(tt.qty); got != tt.want {
+				t.Errorf("RoundQty() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPair_Validate(t *testing.T) {
+	tests := []struct {
+		name  string
+		qty   float64
+		price float64
+		want  error
+	}{
+		{"Valid", 0.001, 60000, nil},
+		{"Below minimum qty", 0.00005, 60000, ErrBelowMinimum},
+		{"Below minimum cost", 0.0001, 1000, ErrBelowMinimum},
+		{"Market order", 0.0001, 0, nil},
+		{"Zero qty", 0, 60000, ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := btcUSD.Validate(tt.qty, tt.price); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistry_Validate(t *testing.T) {
+	r := NewRegistry()
+	r.Set(btcUSD)
+
+	if err := r.Validate("BTC/USD", 0.001, 60000); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	if err := r.Validate("ETH/USD", 0.001, 3000); !errors.Is(err, ErrUnknownPair) {
+		t.Errorf("Validate() error = %v, want %v", err, ErrUnknownPair)
+	}
+}
@@ -0,0 +1,101 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/peetermeos/tabot/internal/app/tabot"
+	"github.com/pkg/errors"
+)
+
+// File appends journal entries to a file, one JSON object per line, so that
+// it can be queried with tools such as jq or imported into a database.
+type File struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFile opens the journal at path for appending, creating it and its
+// directory if needed.
+func NewFile(path string) (*File, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating journal directory")
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening journal")
+	}
+
+	return &File{file: file}, nil
+}
+
+// Record appends the entry to the journal. Each entry is written at once, so
+// that a crash never leaves a partial line behind other than the last one.
+func (f *File) Record(entry tabot.JournalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling journal entry")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, err = f.file.Write(append(line, '\n'))
+	if err != nil {
+		return errors.Wrap(err, "error writing journal entry")
+	}
+
+	return nil
+}
+
+// Close closes the journal file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+// ReadFile reads all entries of the journal at path. A partial last line, as
+// left by a crash, is ignored.
+func ReadFile(path string) ([]tabot.JournalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening journal")
+	}
+
+	defer func() { _ = file.Close() }()
+
+	var entries []tabot.JournalEntry
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var entry tabot.JournalEntry
+
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			// Only the last line can be partial
+			if !scanner.Scan() {
+				break
+			}
+
+			return nil, errors.Wrap(err, "error unmarshalling journal entry")
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading journal")
+	}
+
+	return entries, nil
+}
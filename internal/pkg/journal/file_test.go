@@ -0,0 +1,65 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/peetermeos/tabot/internal/app/tabot"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal", "opportunities.jsonl")
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	entries := []tabot.JournalEntry{
+		{
+			Time:   at,
+			Cycle:  "USD/BTC/ETH",
+			Anchor: "USD",
+			Legs: []tabot.JournalLeg{
+				{Pair: "BTC/USD", From: "USD", To: "BTC", Rate: 0.00002, Depth: 1000, TickTime: at.Add(-time.Second)},
+			},
+			GrossBps: 20,
+			NetBps:   -10,
+			Skipped:  tabot.SkipNotTradeable,
+		},
+		{Time: at, Cycle: "USD/ETH/BTC", Anchor: "USD", Executed: true, NetPnL: 1.5, Error: "leg not filled"},
+	}
+
+	// Entries are appended across reopening the journal
+	for _, entry := range entries {
+		journal, err := NewFile(path)
+		if err != nil {
+			t.Fatalf("NewFile() error = %v", err)
+		}
+
+		if err := journal.Record(entry); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+
+		if err := journal.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+
+	// A crash left a partial line behind
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = file.WriteString(`{"time":"2024-05-01T12:00:00Z","cyc`)
+	_ = file.Close()
+
+	got, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("ReadFile() = %+v, want %+v", got, entries)
+	}
+}
@@ -0,0 +1,279 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peetermeos/tabot/internal/pkg/orderbook"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// bookDepth is the depth of the book subscription, Kraken's default.
+// The checksum always covers the top 10 levels.
+const (
+	bookDepth     = 10
+	checksumDepth = 10
+)
+
+type Level2Book struct {
+	Price float64
+	Qty   float64
+
+	// number of decimals in the price and qty as sent by Kraken
+	priceDecimals int
+	qtyDecimals   int
+}
+
+func (l *Level2Book) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Price json.Number `json:"price"`
+		Qty   json.Number `json:"qty"`
+	}
+
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling level")
+	}
+
+	l.Price, l.priceDecimals, err = parseDecimal(raw.Price)
+	if err != nil {
+		return errors.Wrap(err, "error parsing price")
+	}
+
+	l.Qty, l.qtyDecimals, err = parseDecimal(raw.Qty)
+	if err != nil {
+		return errors.Wrap(err, "error parsing qty")
+	}
+
+	return nil
+}
+
+// bookPrecision is the number of decimals Kraken uses for the prices and
+// quantities of a pair.
+type bookPrecision struct {
+	price int
+	qty   int
+}
+
+// localBook is the order book of a single symbol, patched from the book
+// channel snapshots and updates.
+type localBook struct {
+	book *orderbook.Book
+
+	// precision is either set explicitly or inferred from the data received
+	precision bookPrecision
+	fixed     bool
+
+	// valid is false after a checksum mismatch, until a new snapshot arrives
+	valid bool
+
+	// resyncing is set while the book is being resubscribed
+	resyncing bool
+}
+
+// SetBookPrecision sets the price and qty precision of a pair used for the
+// book checksum. Without it, the precision is inferred from the number of
+// decimals in the received levels, which may cause spurious checksum
+// failures until a level with the full precision has been seen.
+func (c *Client) SetBookPrecision(symbol string, price, qty int) {
+	c.booksMu.Lock()
+	defer c.booksMu.Unlock()
+
+	book := c.localBook(symbol)
+	book.precision = bookPrecision{price: price, qty: qty}
+	book.fixed = true
+}
+
+// OrderBook returns a copy of the maintained order book for the symbol.
+// It is false if there is no valid book for the symbol.
+func (c *Client) OrderBook(symbol string) (*orderbook.Book, bool) {
+	c.booksMu.Lock()
+	defer c.booksMu.Unlock()
+
+	book, ok := c.orderBooks[symbol]
+	if !ok || !book.valid {
+		return nil, false
+	}
+
+	return book.book.Clone(), true
+}
+
+// ChecksumFailures returns the number of book checksum mismatches so far.
+func (c *Client) ChecksumFailures() uint64 {
+	return c.checksumFailures.Load()
+}
+
+// updateBook applies book data to the maintained order book and verifies its
+// checksum. It returns false if the data must not be delivered, either because
+// the book is awaiting a fresh snapshot or because the checksum did not match,
+// in which case a resubscription is started.
+func (c *Client) updateBook(ctx context.Context, data bookData, snapshot bool) bool {
+	c.booksMu.Lock()
+	defer c.booksMu.Unlock()
+
+	book := c.localBook(data.Symbol)
+
+	if !snapshot && !book.valid {
+		return false
+	}
+
+	book.apply(data, snapshot)
+
+	checksum := book.checksum()
+	if checksum == data.Checksum {
+		return true
+	}
+
+	c.checksumFailures.Add(1)
+
+	book.valid = false
+
+	c.logger.WithFields(logrus.Fields{
+		"symbol":   data.Symbol,
+		"checksum": data.Checksum,
+		"local":    checksum,
+	}).Warn("book checksum mismatch, resubscribing")
+
+	if !book.resyncing {
+		book.resyncing = true
+
+		go c.resync(ctx, data.Symbol)
+	}
+
+	return false
+}
+
+// localBook returns the book of the symbol, creating it if needed.
+// The caller must hold c.booksMu.
+func (c *Client) localBook(symbol string) *localBook {
+	book, ok := c.orderBooks[symbol]
+	if !ok {
+		book = &localBook{book: orderbook.New(symbol, bookDepth)}
+		c.orderBooks[symbol] = book
+	}
+
+	return book
+}
+
+// resync resubscribes to the book of the symbol to get a fresh snapshot,
+// retrying with backoff until the subscription is renewed or ctx is done.
+func (c *Client) resync(ctx context.Context, symbol string) {
+	defer func() {
+		c.booksMu.Lock()
+		c.localBook(symbol).resyncing = false
+		c.booksMu.Unlock()
+	}()
+
+	sub := subscription{channel: channelBook, symbol: symbol}
+	logger := c.logger.WithField("symbol", symbol)
+
+	for attempt := 1; ; attempt++ {
+		// Kraken only sends a new snapshot to a new subscription, so the old
+		// one has to be gone first. Not being subscribed any more means an
+		// earlier attempt or a reconnect already dropped it.
+		err := c.unsubscribe(ctx, sub)
+		if err == nil || errors.Is(err, ErrNotSubscribed) {
+			err = c.subscribe(ctx, sub)
+			if err == nil {
+				return
+			}
+		}
+
+		delay := backoff(attempt)
+
+		logger.WithFields(logrus.Fields{
+			"attempt": attempt,
+			"delay":   delay.String(),
+		}).WithError(err).Warn("error resubscribing to book")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (b *localBook) apply(data bookData, snapshot bool) {
+	bids := make([]orderbook.Level, 0, len(data.Bids))
+	asks := make([]orderbook.Level, 0, len(data.Asks))
+
+	for _, level := range data.Bids {
+		bids = append(bids, orderbook.Level{Price: level.Price, Volume: level.Qty})
+		b.infer(level)
+	}
+
+	for _, level := range data.Asks {
+		asks = append(asks, orderbook.Level{Price: level.Price, Volume: level.Qty})
+		b.infer(level)
+	}
+
+	// Levels pushed out of the subscribed depth are not deleted explicitly,
+	// the book drops them by itself
+	if snapshot {
+		b.book.ApplySnapshot(bids, asks)
+		b.valid = true
+
+		return
+	}
+
+	b.book.ApplyUpdate(bids, asks)
+}
+
+func (b *localBook) infer(level Level2Book) {
+	if b.fixed {
+		return
+	}
+
+	b.precision.price = max(b.precision.price, level.priceDecimals)
+	b.precision.qty = max(b.precision.qty, level.qtyDecimals)
+}
+
+// checksum calculates the CRC32 checksum of the top 10 asks followed by the
+// top 10 bids, as described in the Kraken book channel documentation.
+func (b *localBook) checksum() uint32 {
+	var sb strings.Builder
+
+	for _, side := range []orderbook.Side{orderbook.Ask, orderbook.Bid} {
+		for _, level := range b.book.Levels(side, checksumDepth) {
+			sb.WriteString(checksumValue(level.Price, b.precision.price))
+			sb.WriteString(checksumValue(level.Volume, b.precision.qty))
+		}
+	}
+
+	return crc32.ChecksumIEEE([]byte(sb.String()))
+}
+
+// checksumValue formats the value with the given precision, drops the decimal
+// point and the leading zeros.
+func checksumValue(value float64, precision int) string {
+	formatted := strconv.FormatFloat(value, 'f', precision, 64)
+	formatted = strings.Replace(formatted, ".", "", 1)
+
+	return strings.TrimLeft(formatted, "0")
+}
+
+// parseDecimal parses a JSON number and counts its decimals.
+func parseDecimal(number json.Number) (float64, int, error) {
+	value, err := number.Float64()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "error parsing number")
+	}
+
+	str := number.String()
+	if strings.ContainsAny(str, "eE") {
+		str = strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	_, decimals, found := strings.Cut(str, ".")
+	if !found {
+		return value, 0, nil
+	}
+
+	return value, len(decimals), nil
+}
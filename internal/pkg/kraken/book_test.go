@@ -0,0 +1,125 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"hash/crc32"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/peetermeos/tabot/internal/pkg/orderbook"
+)
+
+func Test_localBook_checksum(t *testing.T) {
+	var data bookData
+
+	// The example of the Kraken book checksum guide
+	err := json.Unmarshal([]byte(`{
+		"symbol":"ETH/XBT",
+		"asks":[
+			{"price":0.05005,"qty":0.00000500},{"price":0.05010,"qty":0.00000500},
+			{"price":0.05015,"qty":0.00000500},{"price":0.05020,"qty":0.00000500},
+			{"price":0.05025,"qty":0.00000500},{"price":0.05030,"qty":0.00000500},
+			{"price":0.05035,"qty":0.00000500},{"price":0.05040,"qty":0.00000500},
+			{"price":0.05045,"qty":0.00000500},{"price":0.05050,"qty":0.00000500}
+		],
+		"bids":[
+			{"price":0.05000,"qty":0.00000500},{"price":0.04995,"qty":0.00000500},
+			{"price":0.04990,"qty":0.00000500},{"price":0.04980,"qty":0.00000500},
+			{"price":0.04975,"qty":0.00000500},{"price":0.04970,"qty":0.00000500},
+			{"price":0.04965,"qty":0.00000500},{"price":0.04960,"qty":0.00000500},
+			{"price":0.04955,"qty":0.00000500},{"price":0.04950,"qty":0.00000500}
+		]
+	}`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The precision is inferred from the levels
+	book := &localBook{book: orderbook.New("ETH/XBT", bookDepth)}
+	book.apply(data, true)
+
+	if got, want := book.checksum(), uint32(974947235); got != want {
+		t.Errorf("checksum() = %v, want %v", got, want)
+	}
+}
+
+func TestClient_updateBook(t *testing.T) {
+	c := newTestClient()
+	snapshot := bookData{
+		Symbol:   "ETH/GBP",
+		Bids:     []Level2Book{{Price: 2975.7, Qty: 1.5, priceDecimals: 1, qtyDecimals: 1}},
+		Checksum: crc("29757" + "15"),
+	}
+
+	if !c.updateBook(context.Background(), snapshot, true) {
+		t.Fatal("updateBook() rejected a valid snapshot")
+	}
+
+	update := bookData{
+		Symbol:   "ETH/GBP",
+		Bids:     []Level2Book{{Price: 2975.7, Qty: 2, priceDecimals: 1, qtyDecimals: 1}},
+		Checksum: snapshot.Checksum,
+	}
+
+	if c.updateBook(context.Background(), update, false) {
+		t.Error("updateBook() accepted an update with a wrong checksum")
+	}
+
+	if got := c.ChecksumFailures(); got != 1 {
+		t.Errorf("ChecksumFailures() = %v, want 1", got)
+	}
+
+	if _, ok := c.OrderBook("ETH/GBP"); ok {
+		t.Error("OrderBook() returned a book awaiting a snapshot")
+	}
+}
+
+func crc(s string) uint32 {
+	return crc32.ChecksumIEEE([]byte(s))
+}
+
+func TestClient_resync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := newWSServer(t)
+	c := newConnectedClient(ctx, t, server)
+	conn := server.accept(t)
+
+	sub := subscription{channel: channelBook, symbol: "ETH/GBP"}
+	c.subscriptions[sub] = SubscriptionActive
+
+	done := make(chan struct{})
+
+	go func() {
+		c.resync(ctx, "ETH/GBP")
+		close(done)
+	}()
+
+	// The first unsubscribe is refused, the retry goes through
+	for _, answer := range []struct{ method, err string }{
+		{methodUnsubscribe, "Exceeded msg rate"},
+		{methodUnsubscribe, ""},
+		{methodSubscribe, ""},
+	} {
+		req := receive(t, conn)
+		if req.Method != answer.method || req.Params.Channel != channelBook {
+			t.Fatalf("request = %+v, want %s", req, answer.method)
+		}
+
+		reply(t, conn, req, answer.err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("resync() did not return")
+	}
+
+	want := []Subscription{{Channel: channelBook, Symbol: "ETH/GBP", State: SubscriptionActive}}
+	if got := c.Subscriptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Subscriptions() got = %v, want %v", got, want)
+	}
+}
@@ -6,17 +6,16 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/base64"
-	"encoding/json"
-	"fmt"
-	"github.com/peetermeos/tabot/internal/app/prebot"
-	"io"
 	"net/http"
 	"net/url"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/peetermeos/tabot/internal/app/prebot"
 	"github.com/peetermeos/tabot/internal/app/tabot"
+	"github.com/peetermeos/tabot/internal/pkg/instrument"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -25,392 +24,168 @@ const (
 	contentApplicationJSON = "application/json"
 	contentURLEncoded      = "application/x-www-form-urlencoded"
 
-	krakenWsURL    = "wss://ws.kraken.com/v2"
-	krakenBaseURL  = "https://api.kraken.com"
-	krakenAuthPath = "/0/private/GetWebSocketsToken"
+	krakenWsURL     = "wss://ws.kraken.com/v2"
+	krakenWsAuthURL = "wss://ws-auth.kraken.com/v2"
+	krakenBaseURL   = "https://api.kraken.com"
 
 	httpTimeout = 10 * time.Second
-)
 
-type authResponse struct {
-	Error  []interface{} `json:"error"`
-	Result struct {
-		Token   string `json:"token"`
-		Expires int    `json:"expires"` // seconds
-	} `json:"result"`
-}
+	// readTimeout is how long the connection may stay silent before it is
+	// considered dead. Pings every pingInterval keep a healthy connection
+	// from going silent, writes give up after writeTimeout.
+	readTimeout  = 30 * time.Second
+	pingInterval = 10 * time.Second
+	writeTimeout = 10 * time.Second
+
+	methodPing = "ping"
+
+	channelTicker     = "ticker"
+	channelBook       = "book"
+	channelTrade      = "trade"
+	channelStatus     = "status"
+	channelHeartbeat  = "heartbeat"
+	channelInstrument = "instrument"
+
+	channelExecutions = "executions"
+	channelBalances   = "balances"
+)
 
 type websocketRequest struct {
-	Method string                 `json:"method"`
-	Params websocketRequestParams `json:"params"`
+	Method string `json:"method"`
+	Params any    `json:"params,omitempty"`
+	ReqID  int64  `json:"req_id,omitempty"`
 }
 
 type websocketRequestParams struct {
 	Channel string   `json:"channel"`
-	Symbol  []string `json:"symbol"`
-}
-
-// level1Response is the L1 exchange rate response from Kraken.
-// Sample:
-//
-//	 {
-//			"channel":"ticker",
-//			"type":"snapshot",
-//			"data":[{
-//				"symbol":"BTC/GBP",
-//				"bid":53975.7,
-//				"bid_qty":0.00282754,
-//				"ask":53975.8,
-//				"ask_qty":2.79487918,
-//				"last":53975.7,
-//				"volume":53.42371402,
-//				"vwap":53299.8,
-//				"low":52499.9,
-//				"high":54357.1,
-//				"change":1095.7,
-//				"change_pct":2.07,
-//			}]
-//		}
-type level1Response struct {
-	Channel string `json:"channel"`
-	Type    string `json:"type"`
-	Data    []struct {
-		Symbol    string       `json:"symbol"`
-		Bid       float64      `json:"bid"`
-		BidQty    float64      `json:"bid_qty"`
-		Ask       float64      `json:"ask"`
-		AskQty    float64      `json:"ask_qty"`
-		Last      float64      `json:"last"`
-		Volume    float64      `json:"volume"`
-		Vwap      float64      `json:"vwap"`
-		Low       float64      `json:"low"`
-		High      float64      `json:"high"`
-		Change    float64      `json:"change"`
-		ChangePct float64      `json:"change_pct"`
-		Bids      []Level2Book `json:"bids"`
-		Asks      []Level2Book `json:"asks"`
-		Timestamp time.Time    `json:"timestamp"`
-	} `json:"data"`
-}
-
-type Level2Book struct {
-	Price float64 `json:"price"`
-	Qty   float64 `json:"qty"`
+	Symbol  []string `json:"symbol,omitempty"`
+	Token   string   `json:"token,omitempty"`
 }
 
 type Client struct {
 	logger      logrus.FieldLogger
-	apiKey      string
-	apiSecret   string
+	endpoint    string
+	rest        *RESTClient
 	token       string
 	tokenExpiry time.Time
-	conn        *websocket.Conn
-}
 
-var ErrAuthFailed = errors.New("authentication failed")
-
-func NewClient(ctx context.Context, logger logrus.FieldLogger, apiKey string, apiSecret string) *Client {
-	c := &Client{
-		logger: logger.WithFields(logrus.Fields{
-			"comp": "kraken-client",
-		}),
-		apiKey:    apiKey,
-		apiSecret: apiSecret,
-	}
-
-	err := c.connect(ctx)
-	if err != nil {
-		c.logger.WithError(err).Error("error connecting")
-	}
-
-	return c
-}
+	// mu guards the connection, writes to it and the subscription registry.
+	mu            sync.Mutex
+	conn          *websocket.Conn
+	subscriptions map[subscription]SubscriptionState
+	events        chan ConnectionEvent
 
-// Stream returns a channel of ticks from the Kraken websocket.
-// Sample response for BTC/GBP:
-//
-//	ask=53975.8 base=GBP bid=53975.7 instrument=BTC
-func (c *Client) Stream(ctx context.Context) <-chan tabot.Tick {
-	tickCh := make(chan tabot.Tick)
+	// pendingMu guards requests waiting for their acknowledgement.
+	pendingMu sync.Mutex
+	pending   map[int64]chan Ack
+	reqID     atomic.Int64
 
-	go func() {
-		defer close(tickCh)
+	// booksMu guards the maintained order books.
+	booksMu          sync.Mutex
+	orderBooks       map[string]*localBook
+	checksumFailures atomic.Uint64
 
-		if c.conn == nil {
-			err := c.connect(ctx)
-			if err != nil {
-				c.logger.WithError(err).Error("error connecting")
+	// inbox holds the received messages until they are delivered
+	inbox chan envelope
 
-				return
-			}
-		}
+	instruments *instrument.Registry
 
-		for {
-			_, payload, err := c.conn.ReadMessage()
-			if err != nil {
-				c.logger.WithError(err).Error("error reading message from websocket")
-
-				return
-			}
-
-			c.logger.WithFields(logrus.Fields{
-				"action":  "read_message",
-				"payload": string(payload),
-			}).Debug("received message")
-
-			var unmarshalled level1Response
-
-			err = json.Unmarshal(payload, &unmarshalled)
-			if err != nil {
-				c.logger.WithFields(logrus.Fields{
-					"action":  "unmarshal_message",
-					"payload": string(payload),
-				}).WithError(err).Error("error unmarshalling message")
-
-				continue
-			}
-
-			if unmarshalled.Channel == "ticker" {
-				for _, data := range unmarshalled.Data {
-					tickCh <- tabot.Tick{
-						Symbol: data.Symbol,
-						Bid:    data.Bid,
-						BidQty: data.BidQty,
-						Ask:    data.Ask,
-						AskQty: data.AskQty,
-					}
-				}
-			}
-
-			select {
-			case <-ctx.Done():
-				err = c.conn.Close()
-				if err != nil {
-					c.logger.WithError(err).Error("error closing websocket connection")
-				}
-
-				return
-			default:
-			}
-		}
-	}()
+	ticks  *fanout[tabot.Tick]
+	books  *fanout[prebot.Book]
+	trades *fanout[Trade]
+	status *fanout[Status]
+	acks   *fanout[Ack]
 
-	return tickCh
+	fills          *fanout[Fill]
+	orders         *fanout[OrderStatus]
+	balanceChanges *fanout[BalanceChange]
 }
 
-func (c *Client) Subscribe(symbol string) error {
-	if c.conn == nil {
-		err := c.connect(context.Background())
-		if err != nil {
-			return errors.Wrap(err, "error connecting")
-		}
-	}
-
-	req := websocketRequest{
-		Method: "subscribe",
-		Params: websocketRequestParams{
-			Channel: "ticker",
-			Symbol:  []string{symbol},
-		},
-	}
+var ErrAuthFailed = errors.New("authentication failed")
 
-	reqBody, err := json.Marshal(req)
-	if err != nil {
-		return errors.Wrap(err, "error marshalling request")
-	}
+func NewClient(ctx context.Context, logger logrus.FieldLogger, apiKey string, apiSecret string) *Client {
+	return newClient(ctx, logger.WithField("comp", "kraken-client"), krakenWsURL, apiKey, apiSecret)
+}
 
-	err = c.conn.WriteMessage(websocket.TextMessage, reqBody)
+func newClient(ctx context.Context, logger logrus.FieldLogger, endpoint, apiKey, apiSecret string) *Client {
+	c := &Client{
+		logger:        logger,
+		endpoint:      endpoint,
+		rest:          NewRESTClient(apiKey, apiSecret),
+		subscriptions: make(map[subscription]SubscriptionState),
+		events:        make(chan ConnectionEvent, eventBufferSize),
+		pending:       make(map[int64]chan Ack),
+		orderBooks:    make(map[string]*localBook),
+		inbox:         make(chan envelope, inboxSize),
+		instruments:   instrument.NewRegistry(),
+		ticks:         newFanout[tabot.Tick](),
+		books:         newFanout[prebot.Book](),
+		trades:        newFanout[Trade](),
+		status:        newFanout[Status](),
+		acks:          newFanout[Ack](),
+
+		fills:          newFanout[Fill](),
+		orders:         newFanout[OrderStatus](),
+		balanceChanges: newFanout[BalanceChange](),
+	}
+
+	_, err := c.connection(ctx)
 	if err != nil {
-		return errors.Wrap(err, "error writing message to websocket")
+		c.logger.WithError(err).Error("error connecting")
 	}
 
-	return nil
-}
+	go c.readLoop(ctx)
 
-func (c *Client) Unsubscribe(_ string) error {
-	return nil
+	return c
 }
 
-func (c *Client) StreamBook(ctx context.Context) <-chan prebot.Book {
-	bookCh := make(chan prebot.Book)
-
-	go func() {
-		defer close(bookCh)
-
-		if c.conn == nil {
-			err := c.connect(ctx)
-			if err != nil {
-				c.logger.WithError(err).Error("error connecting")
-
-				return
-			}
-		}
-
-		for {
-			_, payload, err := c.conn.ReadMessage()
-			if err != nil {
-				c.logger.WithError(err).Error("error reading message from websocket")
-
-				return
-			}
-
-			c.logger.WithFields(logrus.Fields{
-				"action":  "read_message",
-				"payload": string(payload),
-			}).Debug("received message")
-
-			var unmarshalled level1Response
-
-			err = json.Unmarshal(payload, &unmarshalled)
-			if err != nil {
-				c.logger.WithFields(logrus.Fields{
-					"action":  "unmarshal_message",
-					"payload": string(payload),
-				}).WithError(err).Error("error unmarshalling message")
-
-				continue
-			}
-
-			if unmarshalled.Channel == "book" {
-				item := prebot.Book{}
-
-				if unmarshalled.Type == "update" {
-					item.IsUpdate = true
-				}
-
-				for _, data := range unmarshalled.Data {
-					item.Symbol = data.Symbol
-
-					for _, bid := range data.Bids {
-						item.Bids = append(item.Bids, prebot.Level2Book{
-							Price:  bid.Price,
-							Volume: bid.Qty,
-						})
-					}
-
-					for _, ask := range data.Asks {
-						item.Asks = append(item.Asks, prebot.Level2Book{
-							Price:  ask.Price,
-							Volume: ask.Qty,
-						})
-					}
-
-					bookCh <- item
-				}
-			}
-
-			select {
-			case <-ctx.Done():
-				err = c.conn.Close()
-				if err != nil {
-					c.logger.WithError(err).Error("error closing websocket connection")
-				}
-
-				return
-			default:
-			}
-		}
-	}()
-
-	return bookCh
-}
+// connection returns the current websocket connection, establishing one
+// if there is none yet.
+func (c *Client) connection(ctx context.Context) (*websocket.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-func (c *Client) SubscribeBook(symbol string) error {
 	if c.conn == nil {
-		err := c.connect(context.Background())
+		err := c.connect(ctx)
 		if err != nil {
-			return errors.Wrap(err, "error connecting")
+			return nil, err
 		}
 	}
 
-	req := websocketRequest{
-		Method: "subscribe",
-		Params: websocketRequestParams{
-			Channel: "book",
-			Symbol:  []string{symbol},
-		},
-	}
+	return c.conn, nil
+}
 
-	reqBody, err := json.Marshal(req)
-	if err != nil {
-		return errors.Wrap(err, "error marshalling request")
-	}
+// authToken returns the websocket auth token, refreshing it if it has expired.
+func (c *Client) authToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	err = c.conn.WriteMessage(websocket.TextMessage, reqBody)
-	if err != nil {
-		return errors.Wrap(err, "error writing message to websocket")
+	if time.Since(c.tokenExpiry) > 0 {
+		err := c.authenticate(ctx)
+		if err != nil {
+			return "", errors.Wrap(err, "error authenticating")
+		}
 	}
 
-	return nil
+	return c.token, nil
 }
 
-func (c *Client) UnsubscribeBook(_ string) error {
-	return nil
-}
-
-// authenticate sends a request to Kraken to authenticate the client for websocket
-// communication. The client's API key and secret are used to sign the request.
+// authenticate requests a websocket token from Kraken. The client's API key
+// and secret are used to sign the request.
 func (c *Client) authenticate(ctx context.Context) error {
-	nonce := time.Now().UnixMilli()
-
-	reqBody := url.Values{}
-	reqBody.Set("nonce", fmt.Sprintf("%d", nonce))
-
-	b64DecodedSecret, err := base64.StdEncoding.DecodeString(c.apiSecret)
-	if err != nil {
-		return errors.Wrap(err, "error decoding secret")
-	}
-
-	signature := getKrakenSignature(krakenAuthPath,
-		url.Values{"nonce": {fmt.Sprintf("%d", nonce)}},
-		b64DecodedSecret)
-
-	urlStr := krakenBaseURL + krakenAuthPath
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, urlStr, strings.NewReader(reqBody.Encode()))
-	if err != nil {
-		return errors.Wrap(err, "error creating request")
-	}
-
-	req.Header.Add("Content-Type", contentURLEncoded)
-	req.Header.Add("Accept", contentApplicationJSON)
-	req.Header.Add("API-Key", c.apiKey)
-	req.Header.Add("API-Sign", signature)
-
-	httpClient := http.Client{
-		Timeout: httpTimeout,
-	}
-
-	resp, err := httpClient.Do(req)
+	token, expires, err := c.rest.webSocketsToken(ctx)
 	if err != nil {
-		return errors.Wrap(err, "error sending request")
-	}
-
-	defer func() { _ = resp.Body.Close() }()
-
-	var unmarshalled authResponse
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return errors.Wrap(err, "error reading response body")
-	}
-
-	err = json.Unmarshal(bodyBytes, &unmarshalled)
-	if err != nil {
-		return errors.Wrap(err, "error unmarshalling response body")
-	}
-
-	if len(unmarshalled.Error) > 0 {
-		return errors.Wrapf(ErrAuthFailed, "error: %v", any(unmarshalled.Error))
+		return err
 	}
 
-	c.token = unmarshalled.Result.Token
-	c.tokenExpiry = time.Now().
-		Add(time.Duration(unmarshalled.Result.Expires) * time.Second)
+	c.token = token
+	c.tokenExpiry = time.Now().Add(expires)
 
 	return nil
 }
 
+// connect dials the websocket endpoint, refreshing the auth token first if it
+// has expired. The caller must hold c.mu.
 func (c *Client) connect(ctx context.Context) error {
 	if time.Since(c.tokenExpiry) > 0 {
 		err := c.authenticate(ctx)
@@ -419,32 +194,44 @@ func (c *Client) connect(ctx context.Context) error {
 		}
 	}
 
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.conn = conn
+
+	c.emit(ConnectionEvent{State: StateConnected, Time: time.Now()})
+
+	return nil
+}
+
+// dial opens a new websocket connection to the endpoint.
+func (c *Client) dial(ctx context.Context) (*websocket.Conn, error) {
 	c.logger.WithFields(logrus.Fields{
 		"action":   "connect",
-		"endpoint": krakenWsURL,
+		"endpoint": c.endpoint,
 	}).Info("connecting")
 
 	h := http.Header{}
 
 	//nolint:bodyclose
-	conn, _, err := websocket.DefaultDialer.Dial(krakenWsURL, h)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, c.endpoint, h)
 	if err != nil {
-		return errors.Wrap(err, "error connecting to websocket")
+		return nil, errors.Wrap(err, "error connecting to websocket")
 	}
 
-	c.conn = conn
-
-	c.conn.SetPongHandler(func(msg string) error {
+	conn.SetPongHandler(func(msg string) error {
 		c.logger.WithFields(logrus.Fields{"action": "pong", "msg": msg}).
 			Debug("received pong")
 
-		return nil
+		return conn.SetReadDeadline(time.Now().Add(readTimeout))
 	})
 
 	c.logger.WithFields(logrus.Fields{"action": "connect"}).
 		Info("success")
 
-	return nil
+	return conn, nil
 }
 
 func getKrakenSignature(urlPath string, values url.Values, secret []byte) string {
@@ -3,7 +3,10 @@ package kraken
 import (
 	"context"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -32,9 +35,8 @@ func TestClient_authenticate(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			c := &Client{
-				logger:    logrus.New(),
-				apiKey:    tt.fields.apiKey,
-				apiSecret: tt.fields.apiSecret,
+				logger: logrus.New(),
+				rest:   NewRESTClient(tt.fields.apiKey, tt.fields.apiSecret),
 			}
 
 			if err := c.authenticate(context.Background()); (err != nil) != tt.wantErr {
@@ -45,3 +47,84 @@ func TestClient_authenticate(t *testing.T) {
 		})
 	}
 }
+
+func Test_backoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		attempt int
+		lower   time.Duration
+		upper   time.Duration
+	}{
+		{"First attempt", 1, reconnectBaseDelay / 2, reconnectBaseDelay},
+		{"Third attempt", 3, 2 * reconnectBaseDelay, 4 * reconnectBaseDelay},
+		{"Capped", 100, reconnectMaxDelay / 2, reconnectMaxDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backoff(tt.attempt); got < tt.lower || got > tt.upper {
+				t.Errorf("backoff() = %v, want between %v and %v", got, tt.lower, tt.upper)
+			}
+		})
+	}
+}
+
+func TestClient_reconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := newWSServer(t)
+	c := newConnectedClient(ctx, t, server)
+	conn := server.accept(t)
+
+	subscribed := make(chan error)
+
+	for _, subscribe := range []func(context.Context, string) error{c.Subscribe, c.SubscribeBook} {
+		go func() { subscribed <- subscribe(ctx, "BTC/USD") }()
+
+		reply(t, conn, receive(t, conn), "")
+
+		if err := <-subscribed; err != nil {
+			t.Fatalf("subscribe error = %v", err)
+		}
+	}
+
+	// The server drops the connection, the client redials and replays both
+	// subscriptions on the new one
+	_ = conn.Close()
+
+	conn = server.accept(t)
+
+	replayed := make(map[string]bool)
+
+	for range 2 {
+		req := receive(t, conn)
+		if req.Method != methodSubscribe {
+			t.Errorf("replayed method = %s, want %s", req.Method, methodSubscribe)
+		}
+
+		replayed[req.Params.Channel+" "+strings.Join(req.Params.Symbol, ",")] = true
+
+		reply(t, conn, req, "")
+	}
+
+	if !replayed["ticker BTC/USD"] || !replayed["book BTC/USD"] {
+		t.Errorf("replayed %v", replayed)
+	}
+
+	var states []ConnectionState
+
+	for len(states) == 0 || states[len(states)-1] != StateResubscribed {
+		select {
+		case event := <-c.Events():
+			states = append(states, event.State)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got events %v", states)
+		}
+	}
+
+	want := []ConnectionState{StateConnected, StateReconnecting, StateConnected, StateResubscribed}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("events = %v, want %v", states, want)
+	}
+}
@@ -0,0 +1,90 @@
+package kraken
+
+import (
+	"context"
+	"sync"
+)
+
+// subscriber is a single consumer of a fanout.
+type subscriber[T any] struct {
+	ch   chan T
+	done <-chan struct{}
+}
+
+// fanout delivers values of one message type to any number of subscribers.
+// A subscriber is removed and its channel closed once its context is done.
+type fanout[T any] struct {
+	mu     sync.RWMutex
+	subs   map[*subscriber[T]]struct{}
+	closed bool
+}
+
+func newFanout[T any]() *fanout[T] {
+	return &fanout[T]{subs: make(map[*subscriber[T]]struct{})}
+}
+
+// add registers a new subscriber for the lifetime of ctx.
+func (f *fanout[T]) add(ctx context.Context) <-chan T {
+	sub := &subscriber[T]{
+		ch:   make(chan T),
+		done: ctx.Done(),
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		close(sub.ch)
+
+		return sub.ch
+	}
+
+	f.subs[sub] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+		f.remove(sub)
+	}()
+
+	return sub.ch
+}
+
+func (f *fanout[T]) remove(sub *subscriber[T]) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.subs[sub]; !ok {
+		return
+	}
+
+	delete(f.subs, sub)
+	close(sub.ch)
+}
+
+// publish delivers value to every subscriber, blocking until each of them
+// has either received it or gone away.
+func (f *fanout[T]) publish(value T) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for sub := range f.subs {
+		select {
+		case sub.ch <- value:
+		case <-sub.done:
+		}
+	}
+}
+
+// close closes all subscriber channels. Subscribers added afterwards receive
+// an already closed channel.
+func (f *fanout[T]) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for sub := range f.subs {
+		delete(f.subs, sub)
+		close(sub.ch)
+	}
+
+	f.closed = true
+}
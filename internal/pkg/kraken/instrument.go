@@ -0,0 +1,114 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/peetermeos/tabot/internal/app/tabot"
+	"github.com/peetermeos/tabot/internal/pkg/instrument"
+	"github.com/peetermeos/tabot/internal/pkg/symbol"
+	"github.com/pkg/errors"
+)
+
+// statusOnline is the status of a pair that is trading normally.
+const statusOnline = "online"
+
+// instrumentData is the data of the instrument channel. Snapshots list all
+// assets and pairs, updates only the changed ones.
+type instrumentData struct {
+	Pairs []pairData `json:"pairs"`
+}
+
+type pairData struct {
+	Symbol         string  `json:"symbol"`
+	Base           string  `json:"base"`
+	Quote          string  `json:"quote"`
+	Status         string  `json:"status"`
+	PricePrecision int     `json:"price_precision"`
+	PriceIncrement float64 `json:"price_increment"`
+	QtyPrecision   int     `json:"qty_precision"`
+	QtyIncrement   float64 `json:"qty_increment"`
+	QtyMin         float64 `json:"qty_min"`
+	CostMin        float64 `json:"cost_min"`
+}
+
+// SubscribeInstruments subscribes to the metadata of all pairs. It keeps the
+// instrument registry and the book checksum precision up to date.
+func (c *Client) SubscribeInstruments(ctx context.Context) error {
+	return c.subscribe(ctx, subscription{channel: channelInstrument})
+}
+
+// Instruments returns the registry of the pairs received from the instrument
+// channel.
+func (c *Client) Instruments() *instrument.Registry {
+	return c.instruments
+}
+
+// Pairs lists the pairs trading on Kraken with their canonical currency
+// codes, as used by the websocket API.
+func (c *Client) Pairs(ctx context.Context) ([]tabot.Pair, error) {
+	assetPairs, err := c.rest.AssetPairs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make([]tabot.Pair, 0, len(assetPairs))
+
+	for name, item := range assetPairs {
+		if item.Status != "" && item.Status != statusOnline {
+			continue
+		}
+
+		base, errBase := symbol.Kraken.Canonical(item.Base)
+		quote, errQuote := symbol.Kraken.Canonical(item.Quote)
+
+		if errBase != nil || errQuote != nil {
+			c.logger.WithField("pair", name).Debug("ignoring pair with unknown assets")
+
+			continue
+		}
+
+		pairs = append(pairs, tabot.Pair{
+			Symbol: base + "/" + quote,
+			Base:   base,
+			Quote:  quote,
+		})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Symbol < pairs[j].Symbol })
+
+	return pairs, nil
+}
+
+func (c *Client) dispatchInstruments(payload json.RawMessage) error {
+	var data instrumentData
+
+	err := json.Unmarshal(payload, &data)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling instrument data")
+	}
+
+	pairs := make([]instrument.Pair, 0, len(data.Pairs))
+
+	for _, item := range data.Pairs {
+		pairs = append(pairs, instrument.Pair{
+			Symbol:         item.Symbol,
+			Base:           item.Base,
+			Quote:          item.Quote,
+			Status:         item.Status,
+			PricePrecision: item.PricePrecision,
+			PriceIncrement: item.PriceIncrement,
+			QtyPrecision:   item.QtyPrecision,
+			QtyIncrement:   item.QtyIncrement,
+			QtyMin:         item.QtyMin,
+			CostMin:        item.CostMin,
+		})
+
+		c.SetBookPrecision(item.Symbol, item.PricePrecision, item.QtyPrecision)
+	}
+
+	c.instruments.Set(pairs...)
+
+	return nil
+}
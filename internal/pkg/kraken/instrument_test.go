@@ -0,0 +1,137 @@
+package kraken
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/peetermeos/tabot/internal/app/tabot"
+	"github.com/peetermeos/tabot/internal/pkg/instrument"
+	"github.com/pkg/errors"
+)
+
+func TestClient_dispatchInstruments(t *testing.T) {
+	c := newTestClient()
+	c.subscriptions[subscription{channel: channelInstrument}] = SubscriptionActive
+
+	payload := `{"channel":"instrument","type":"snapshot","data":{
+		"assets":[{"id":"BTC","status":"enabled","precision":10}],
+		"pairs":[{"symbol":"BTC/USD","base":"BTC","quote":"USD","status":"online",
+			"qty_precision":8,"qty_increment":0.00000001,"price_precision":1,
+			"cost_precision":5,"marginable":true,"has_index":true,"cost_min":0.5,
+			"tick_size":0.1,"price_increment":0.1,"qty_min":0.0001}]
+	}}`
+
+	err := c.dispatch(context.Background(), []byte(payload))
+	if err != nil {
+		t.Fatalf("dispatch() error = %v", err)
+	}
+
+	pair, ok := c.Instruments().Get("BTC/USD")
+	if !ok || pair.QtyMin != 0.0001 || pair.PriceIncrement != 0.1 || pair.CostMin != 0.5 {
+		t.Errorf("pair got = %+v, %v", pair, ok)
+	}
+
+	book := c.orderBooks["BTC/USD"]
+	if book == nil || !book.fixed || book.precision != (bookPrecision{price: 1, qty: 8}) {
+		t.Errorf("book precision got = %+v", book)
+	}
+}
+
+func TestClient_Pairs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/0/public/AssetPairs" {
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+
+		_, _ = w.Write([]byte(`{"error":[],"result":{
+			"XXBTZUSD":{"altname":"XBTUSD","wsname":"XBT/USD","base":"XXBT","quote":"ZUSD","status":"online"},
+			"XDGEUR":{"altname":"XDGEUR","wsname":"XDG/EUR","base":"XXDG","quote":"ZEUR","status":"online"},
+			"USDTZUSD":{"altname":"USDTUSD","wsname":"USDT/USD","base":"USDT","quote":"ZUSD","status":"online"},
+			"XETHZUSD":{"altname":"ETHUSD","wsname":"ETH/USD","base":"XETH","quote":"ZUSD","status":"delisted"}
+		}}`))
+	}))
+	defer server.Close()
+
+	c := newTestClient()
+	c.rest = NewRESTClient("key", "c2VjcmV0")
+	c.rest.baseURL = server.URL
+
+	got, err := c.Pairs(context.Background())
+	if err != nil {
+		t.Fatalf("Pairs() error = %v", err)
+	}
+
+	want := []tabot.Pair{
+		{Symbol: "BTC/USD", Base: "BTC", Quote: "USD"},
+		{Symbol: "DOGE/EUR", Base: "DOGE", Quote: "EUR"},
+		{Symbol: "USDT/USD", Base: "USDT", Quote: "USD"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Pairs() = %v, want %v", got, want)
+	}
+}
+
+func TestTrader_normalize(t *testing.T) {
+	c := newTestClient()
+	c.instruments.Set(instrument.Pair{
+		Symbol:         "BTC/USD",
+		PricePrecision: 1,
+		PriceIncrement: 0.1,
+		QtyPrecision:   8,
+		QtyIncrement:   0.00000001,
+		QtyMin:         0.0001,
+		CostMin:        0.5,
+	})
+
+	trader := &Trader{client: c}
+
+	tests := []struct {
+		name    string
+		req     OrderRequest
+		want    OrderRequest
+		wantErr error
+	}{
+		{
+			name: "Rounded",
+			req:  OrderRequest{Symbol: "BTC/USD", Type: OrderTypeLimit, Qty: 0.123456789, LimitPrice: 60000.16},
+			want: OrderRequest{Symbol: "BTC/USD", Type: OrderTypeLimit, Qty: 0.12345678, LimitPrice: 60000.2},
+		},
+		{
+			name: "Sell limit rounded down",
+			req:  OrderRequest{Symbol: "BTC/USD", Side: SideSell, Type: OrderTypeLimit, Qty: 0.1, LimitPrice: 60000.16},
+			want: OrderRequest{Symbol: "BTC/USD", Side: SideSell, Type: OrderTypeLimit, Qty: 0.1, LimitPrice: 60000.1},
+		},
+		{
+			name: "Buy limit rounded up",
+			req:  OrderRequest{Symbol: "BTC/USD", Side: SideBuy, Type: OrderTypeLimit, Qty: 0.1, LimitPrice: 60000.14},
+			want: OrderRequest{Symbol: "BTC/USD", Side: SideBuy, Type: OrderTypeLimit, Qty: 0.1, LimitPrice: 60000.2},
+		},
+		{
+			name:    "Below minimum cost",
+			req:     OrderRequest{Symbol: "BTC/USD", Type: OrderTypeLimit, Qty: 0.0001, LimitPrice: 1000},
+			wantErr: ErrOrderMinimum,
+		},
+		{
+			name: "Unknown pair",
+			req:  OrderRequest{Symbol: "ETH/USD", Type: OrderTypeMarket, Qty: 0.123456789},
+			want: OrderRequest{Symbol: "ETH/USD", Type: OrderTypeMarket, Qty: 0.123456789},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := trader.normalize(tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("normalize() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && got != tt.want {
+				t.Errorf("normalize() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const execTypeTrade = "trade"
+
+// executionData is an item of the executions channel. Trade executions carry
+// the last fill, all of them carry the order status.
+type executionData struct {
+	OrderID       string    `json:"order_id"`
+	ExecID        string    `json:"exec_id"`
+	ExecType      string    `json:"exec_type"`
+	ClientOrderID string    `json:"cl_ord_id"`
+	Symbol        string    `json:"symbol"`
+	Side          string    `json:"side"`
+	OrderType     string    `json:"order_type"`
+	OrderQty      float64   `json:"order_qty"`
+	LimitPrice    float64   `json:"limit_price"`
+	OrderStatus   string    `json:"order_status"`
+	CumQty        float64   `json:"cum_qty"`
+	CumCost       float64   `json:"cum_cost"`
+	AvgPrice      float64   `json:"avg_price"`
+	LastQty       float64   `json:"last_qty"`
+	LastPrice     float64   `json:"last_price"`
+	LiquidityInd  string    `json:"liquidity_ind"`
+	Fees          []feeData `json:"fees"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+type feeData struct {
+	Asset string  `json:"asset"`
+	Qty   float64 `json:"qty"`
+}
+
+// balanceData is an item of the balances channel. Snapshots only carry the
+// asset and its balance, updates describe the ledger entry as well.
+type balanceData struct {
+	Asset     string    `json:"asset"`
+	Balance   float64   `json:"balance"`
+	Amount    float64   `json:"amount"`
+	Fee       float64   `json:"fee"`
+	Type      string    `json:"type"`
+	LedgerID  string    `json:"ledger_id"`
+	RefID     string    `json:"ref_id"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Fill is a single (partial) fill of one of our orders.
+type Fill struct {
+	OrderID   string
+	ExecID    string
+	Symbol    string
+	Side      string
+	Qty       float64
+	Price     float64
+	Fee       float64
+	FeeAsset  string
+	Maker     bool
+	Timestamp time.Time
+}
+
+// OrderStatus is the state of one of our orders after an execution event.
+type OrderStatus struct {
+	OrderID       string
+	ClientOrderID string
+	ExecType      string
+	Symbol        string
+	Side          string
+	OrderType     string
+	Status        string
+	Qty           float64
+	LimitPrice    float64
+	CumQty        float64
+	AvgPrice      float64
+	Timestamp     time.Time
+}
+
+// BalanceChange is a change of the balance of an asset. Snapshot changes
+// report the balance at the time of subscription and carry no amount.
+type BalanceChange struct {
+	Asset     string
+	Balance   float64
+	Amount    float64
+	Fee       float64
+	Type      string
+	LedgerID  string
+	RefID     string
+	Snapshot  bool
+	Timestamp time.Time
+}
+
+// SubscribeExecutions subscribes to the fills and status changes of our orders.
+func (t *Trader) SubscribeExecutions(ctx context.Context) error {
+	return t.client.subscribe(ctx, subscription{channel: channelExecutions})
+}
+
+// SubscribeBalances subscribes to the account balances.
+func (t *Trader) SubscribeBalances(ctx context.Context) error {
+	return t.client.subscribe(ctx, subscription{channel: channelBalances})
+}
+
+// StreamFills returns a channel of fills of our orders.
+func (t *Trader) StreamFills(ctx context.Context) <-chan Fill {
+	return t.client.fills.add(ctx)
+}
+
+// StreamOrders returns a channel of status changes of our orders.
+func (t *Trader) StreamOrders(ctx context.Context) <-chan OrderStatus {
+	return t.client.orders.add(ctx)
+}
+
+// StreamBalances returns a channel of balance changes.
+func (t *Trader) StreamBalances(ctx context.Context) <-chan BalanceChange {
+	return t.client.balanceChanges.add(ctx)
+}
+
+// Balances returns the last known balance of every asset.
+func (t *Trader) Balances() map[string]float64 {
+	t.balancesMu.Lock()
+	defer t.balancesMu.Unlock()
+
+	balances := make(map[string]float64, len(t.balances))
+
+	for asset, balance := range t.balances {
+		balances[asset] = balance
+	}
+
+	return balances
+}
+
+// trackBalances keeps the balances up to date from the balances channel.
+func (t *Trader) trackBalances(ctx context.Context) {
+	for change := range t.client.balanceChanges.add(ctx) {
+		t.balancesMu.Lock()
+		t.balances[change.Asset] = change.Balance
+		t.balancesMu.Unlock()
+	}
+}
+
+func (c *Client) dispatchExecutions(payload json.RawMessage) error {
+	var data []executionData
+
+	err := json.Unmarshal(payload, &data)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling executions data")
+	}
+
+	for _, item := range data {
+		if item.ExecType == execTypeTrade {
+			fill := Fill{
+				OrderID:   item.OrderID,
+				ExecID:    item.ExecID,
+				Symbol:    item.Symbol,
+				Side:      item.Side,
+				Qty:       item.LastQty,
+				Price:     item.LastPrice,
+				Maker:     item.LiquidityInd == "m",
+				Timestamp: item.Timestamp,
+			}
+
+			for _, fee := range item.Fees {
+				fill.Fee += fee.Qty
+				fill.FeeAsset = fee.Asset
+			}
+
+			c.fills.publish(fill)
+		}
+
+		c.orders.publish(OrderStatus{
+			OrderID:       item.OrderID,
+			ClientOrderID: item.ClientOrderID,
+			ExecType:      item.ExecType,
+			Symbol:        item.Symbol,
+			Side:          item.Side,
+			OrderType:     item.OrderType,
+			Status:        item.OrderStatus,
+			Qty:           item.OrderQty,
+			LimitPrice:    item.LimitPrice,
+			CumQty:        item.CumQty,
+			AvgPrice:      item.AvgPrice,
+			Timestamp:     item.Timestamp,
+		})
+	}
+
+	return nil
+}
+
+func (c *Client) dispatchBalances(payload json.RawMessage, snapshot bool) error {
+	var data []balanceData
+
+	err := json.Unmarshal(payload, &data)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling balances data")
+	}
+
+	for _, item := range data {
+		c.balanceChanges.publish(BalanceChange{
+			Asset:     item.Asset,
+			Balance:   item.Balance,
+			Amount:    item.Amount,
+			Fee:       item.Fee,
+			Type:      item.Type,
+			LedgerID:  item.LedgerID,
+			RefID:     item.RefID,
+			Snapshot:  snapshot,
+			Timestamp: item.Timestamp,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package kraken
+
+import (
+	"context"
+	"testing"
+)
+
+func TestClient_dispatchExecutions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := newTestClient()
+	c.subscriptions[subscription{channel: channelExecutions}] = SubscriptionActive
+
+	fills := c.fills.add(ctx)
+	orders := c.orders.add(ctx)
+
+	payload := `{"channel":"executions","type":"update","data":[{
+		"order_id":"OK4GJX-KSTLS-7DZZO5","exec_id":"TJE7HC-DKBTI-5BFVKE","exec_type":"trade",
+		"symbol":"BTC/USD","side":"buy","order_type":"limit","order_qty":0.5,"limit_price":60000,
+		"order_status":"partially_filled","cum_qty":0.2,"avg_price":59990,
+		"last_qty":0.2,"last_price":59990,"liquidity_ind":"t",
+		"fees":[{"asset":"USD","qty":47.99}],"timestamp":"2024-05-18T09:12:31.123456Z"
+	}]}`
+
+	go func() {
+		if err := c.dispatch(ctx, []byte(payload)); err != nil {
+			t.Errorf("dispatch() error = %v", err)
+		}
+	}()
+
+	fill := <-fills
+	if fill.OrderID != "OK4GJX-KSTLS-7DZZO5" || fill.Qty != 0.2 || fill.Price != 59990 ||
+		fill.Fee != 47.99 || fill.FeeAsset != "USD" || fill.Maker {
+		t.Errorf("fill got = %+v", fill)
+	}
+
+	order := <-orders
+	if order.Status != "partially_filled" || order.CumQty != 0.2 || order.Qty != 0.5 {
+		t.Errorf("order status got = %+v", order)
+	}
+}
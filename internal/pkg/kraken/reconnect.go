@@ -0,0 +1,201 @@
+package kraken
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	reconnectBaseDelay = 500 * time.Millisecond
+	reconnectMaxDelay  = 30 * time.Second
+
+	eventBufferSize = 16
+)
+
+// ConnectionState is a state of the websocket connection lifecycle.
+type ConnectionState int
+
+const (
+	// StateConnected is reported every time a websocket connection is established.
+	StateConnected ConnectionState = iota
+	// StateReconnecting is reported before every reconnection attempt.
+	StateReconnecting
+	// StateResubscribed is reported once all active subscriptions have been
+	// replayed on a new connection.
+	StateResubscribed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateResubscribed:
+		return "resubscribed"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnectionEvent describes a connection state transition.
+type ConnectionEvent struct {
+	State   ConnectionState
+	Attempt int   // reconnection attempt, set for StateReconnecting
+	Err     error // cause of the reconnection, set for StateReconnecting
+	Time    time.Time
+}
+
+// Events returns a channel of connection state transitions. Events are dropped
+// if the consumer does not keep up.
+func (c *Client) Events() <-chan ConnectionEvent {
+	return c.events
+}
+
+func (c *Client) emit(event ConnectionEvent) {
+	select {
+	case c.events <- event:
+	default:
+		c.logger.WithField("state", event.State.String()).Debug("dropping connection event")
+	}
+}
+
+// reconnect replaces the failed connection with a new one, retrying with
+// exponential backoff until it succeeds or ctx is done, and replays all
+// active subscriptions. If the connection has already been replaced by
+// another reader, reconnect returns immediately. The lock is only held to
+// swap the connection, so that subscriptions can be registered and data
+// filtered while waiting.
+func (c *Client) reconnect(ctx context.Context, failed *websocket.Conn, cause error) error {
+	c.mu.Lock()
+
+	if c.conn != failed {
+		c.mu.Unlock()
+
+		return nil
+	}
+
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+
+	c.mu.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		c.emit(ConnectionEvent{
+			State:   StateReconnecting,
+			Attempt: attempt,
+			Err:     cause,
+			Time:    time.Now(),
+		})
+
+		delay := backoff(attempt)
+
+		c.logger.WithFields(logrus.Fields{
+			"action":  "reconnect",
+			"attempt": attempt,
+			"delay":   delay.String(),
+		}).WithError(cause).Warn("reconnecting")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		var conn *websocket.Conn
+
+		_, cause = c.authToken(ctx)
+		if cause == nil {
+			conn, cause = c.dial(ctx)
+		}
+
+		if cause == nil {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			c.conn = conn
+
+			c.emit(ConnectionEvent{State: StateConnected, Time: time.Now()})
+			c.resubscribe()
+
+			return nil
+		}
+	}
+}
+
+// keepalive pings Kraken every pingInterval, so that a healthy connection
+// never stays silent long enough to hit the read deadline.
+func (c *Client) keepalive(ctx context.Context) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+
+		if c.conn != nil {
+			err := c.send(methodPing, nil, c.reqID.Add(1))
+			if err != nil {
+				// A dead connection is detected by the read deadline
+				c.logger.WithError(err).Debug("error sending ping")
+			}
+		}
+
+		c.mu.Unlock()
+	}
+}
+
+// resubscribe replays all subscriptions on the current connection. Pending
+// unsubscriptions are dropped, as the new connection has no such subscription.
+// The caller must hold c.mu.
+func (c *Client) resubscribe() {
+	for sub, state := range c.subscriptions {
+		if state == SubscriptionUnsubscribing {
+			delete(c.subscriptions, sub)
+
+			continue
+		}
+
+		c.subscriptions[sub] = SubscriptionPending
+
+		err := c.send(methodSubscribe, sub.params(c.token), c.reqID.Add(1))
+		if err != nil {
+			// The connection is most likely gone again, the next read will
+			// fail and trigger another reconnect.
+			c.logger.WithFields(logrus.Fields{
+				"channel": sub.channel,
+				"symbol":  sub.symbol,
+			}).WithError(err).Error("error resubscribing")
+
+			return
+		}
+	}
+
+	c.emit(ConnectionEvent{State: StateResubscribed, Time: time.Now()})
+}
+
+// backoff returns the delay before the given reconnection attempt. The delay
+// doubles with every attempt up to reconnectMaxDelay, half of it is jittered.
+func backoff(attempt int) time.Duration {
+	delay := reconnectBaseDelay
+
+	for i := 1; i < attempt && delay < reconnectMaxDelay; i++ {
+		delay *= 2
+	}
+
+	delay = min(delay, reconnectMaxDelay)
+
+	//nolint:gosec // jitter does not need a cryptographically secure source
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -0,0 +1,445 @@
+package kraken
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/peetermeos/tabot/internal/pkg/fees"
+	"github.com/peetermeos/tabot/internal/pkg/symbol"
+	"github.com/pkg/errors"
+)
+
+const (
+	restPublicPath  = "/0/public/"
+	restPrivatePath = "/0/private/"
+
+	percent = 100
+)
+
+// lastNonce is shared by all REST clients in the process, as Kraken requires
+// the nonces of an API key to be increasing across all of its sessions.
+var lastNonce atomic.Int64
+
+// Decimal is a number Kraken sends either as a JSON number or a string.
+type Decimal float64
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	str := strings.Trim(string(data), `"`)
+	if str == "" {
+		*d = 0
+
+		return nil
+	}
+
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return errors.Wrapf(err, "error parsing decimal %s", str)
+	}
+
+	*d = Decimal(value)
+
+	return nil
+}
+
+type restResponse struct {
+	Error  []string        `json:"error"`
+	Result json.RawMessage `json:"result"`
+}
+
+// TradeBalance is the margin account summary in the requested asset.
+type TradeBalance struct {
+	EquivalentBalance Decimal `json:"eb"`
+	TradeBalance      Decimal `json:"tb"`
+	MarginUsed        Decimal `json:"m"`
+	UnrealizedPnL     Decimal `json:"n"`
+	Cost              Decimal `json:"c"`
+	Valuation         Decimal `json:"v"`
+	Equity            Decimal `json:"e"`
+	FreeMargin        Decimal `json:"mf"`
+	MarginLevel       Decimal `json:"ml"`
+}
+
+// OrderInfo is an open or closed order.
+type OrderInfo struct {
+	RefID       string  `json:"refid"`
+	UserRef     int64   `json:"userref"`
+	Status      string  `json:"status"`
+	OpenTime    float64 `json:"opentm"`
+	CloseTime   float64 `json:"closetm"`
+	Description struct {
+		Pair      string  `json:"pair"`
+		Side      string  `json:"type"`
+		OrderType string  `json:"ordertype"`
+		Price     Decimal `json:"price"`
+		Order     string  `json:"order"`
+	} `json:"descr"`
+	Volume     Decimal `json:"vol"`
+	VolumeExec Decimal `json:"vol_exec"`
+	Cost       Decimal `json:"cost"`
+	Fee        Decimal `json:"fee"`
+	Price      Decimal `json:"price"`
+	LimitPrice Decimal `json:"limitprice"`
+	Reason     string  `json:"reason"`
+}
+
+// TradeInfo is a single trade of the account.
+type TradeInfo struct {
+	OrderID   string  `json:"ordertxid"`
+	Pair      string  `json:"pair"`
+	Time      float64 `json:"time"`
+	Side      string  `json:"type"`
+	OrderType string  `json:"ordertype"`
+	Price     Decimal `json:"price"`
+	Cost      Decimal `json:"cost"`
+	Fee       Decimal `json:"fee"`
+	Volume    Decimal `json:"vol"`
+	Maker     bool    `json:"maker"`
+}
+
+// LedgerEntry is a single change of an asset balance.
+type LedgerEntry struct {
+	RefID   string  `json:"refid"`
+	Time    float64 `json:"time"`
+	Type    string  `json:"type"`
+	SubType string  `json:"subtype"`
+	Asset   string  `json:"asset"`
+	Amount  Decimal `json:"amount"`
+	Fee     Decimal `json:"fee"`
+	Balance Decimal `json:"balance"`
+}
+
+// FeeTier is the fee of a pair for the current 30 day volume, in percent.
+type FeeTier struct {
+	Fee        Decimal `json:"fee"`
+	MinFee     Decimal `json:"minfee"`
+	MaxFee     Decimal `json:"maxfee"`
+	NextFee    Decimal `json:"nextfee"`
+	NextVolume Decimal `json:"nextvolume"`
+	TierVolume Decimal `json:"tiervolume"`
+}
+
+// TradeVolume is the 30 day trade volume of the account and the resulting
+// taker and maker fee tiers per pair.
+type TradeVolume struct {
+	Currency  string             `json:"currency"`
+	Volume    Decimal            `json:"volume"`
+	Fees      map[string]FeeTier `json:"fees"`
+	FeesMaker map[string]FeeTier `json:"fees_maker"`
+}
+
+// AssetPair is a pair listed on Kraken. Base and quote are Kraken asset
+// codes, such as XXBT and ZUSD.
+type AssetPair struct {
+	Altname  string  `json:"altname"`
+	WSName   string  `json:"wsname"`
+	Base     string  `json:"base"`
+	Quote    string  `json:"quote"`
+	Status   string  `json:"status"`
+	OrderMin Decimal `json:"ordermin"`
+	CostMin  Decimal `json:"costmin"`
+	TickSize Decimal `json:"tick_size"`
+}
+
+// RESTClient calls the Kraken REST API.
+type RESTClient struct {
+	apiKey     string
+	apiSecret  string
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewRESTClient(apiKey string, apiSecret string) *RESTClient {
+	return &RESTClient{
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		baseURL:   krakenBaseURL,
+		httpClient: &http.Client{
+			Timeout: httpTimeout,
+		},
+	}
+}
+
+// AssetPairs returns all pairs listed on Kraken, keyed by the pair name.
+func (r *RESTClient) AssetPairs(ctx context.Context) (map[string]AssetPair, error) {
+	var result map[string]AssetPair
+
+	err := r.public(ctx, "AssetPairs", nil, &result)
+
+	return result, err
+}
+
+// Balance returns the balances of all assets.
+func (r *RESTClient) Balance(ctx context.Context) (map[string]float64, error) {
+	var result map[string]Decimal
+
+	err := r.private(ctx, "Balance", nil, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make(map[string]float64, len(result))
+
+	for asset, balance := range result {
+		balances[asset] = float64(balance)
+	}
+
+	return balances, nil
+}
+
+// TradeBalance returns the margin account summary valued in asset.
+func (r *RESTClient) TradeBalance(ctx context.Context, asset string) (TradeBalance, error) {
+	var result TradeBalance
+
+	err := r.private(ctx, "TradeBalance", url.Values{"asset": {asset}}, &result)
+
+	return result, err
+}
+
+// OpenOrders returns the open orders keyed by order ID.
+func (r *RESTClient) OpenOrders(ctx context.Context) (map[string]OrderInfo, error) {
+	var result struct {
+		Open map[string]OrderInfo `json:"open"`
+	}
+
+	err := r.private(ctx, "OpenOrders", nil, &result)
+
+	return result.Open, err
+}
+
+// ClosedOrders returns the orders closed since start, keyed by order ID.
+// Kraken returns at most 50 orders per call.
+func (r *RESTClient) ClosedOrders(ctx context.Context, start time.Time) (map[string]OrderInfo, error) {
+	var result struct {
+		Closed map[string]OrderInfo `json:"closed"`
+	}
+
+	err := r.private(ctx, "ClosedOrders", since(start), &result)
+
+	return result.Closed, err
+}
+
+// TradesHistory returns the trades since start, keyed by trade ID.
+// Kraken returns at most 50 trades per call.
+func (r *RESTClient) TradesHistory(ctx context.Context, start time.Time) (map[string]TradeInfo, error) {
+	var result struct {
+		Trades map[string]TradeInfo `json:"trades"`
+	}
+
+	err := r.private(ctx, "TradesHistory", since(start), &result)
+
+	return result.Trades, err
+}
+
+// Ledgers returns the ledger entries since start, keyed by ledger ID.
+// Kraken returns at most 50 entries per call.
+func (r *RESTClient) Ledgers(ctx context.Context, start time.Time) (map[string]LedgerEntry, error) {
+	var result struct {
+		Ledger map[string]LedgerEntry `json:"ledger"`
+	}
+
+	err := r.private(ctx, "Ledgers", since(start), &result)
+
+	return result.Ledger, err
+}
+
+// TradeVolume returns the 30 day trade volume and the fee tiers of the pairs.
+func (r *RESTClient) TradeVolume(ctx context.Context, pairs ...string) (TradeVolume, error) {
+	var result TradeVolume
+
+	values := url.Values{}
+	if len(pairs) > 0 {
+		values.Set("pair", strings.Join(pairs, ","))
+	}
+
+	err := r.private(ctx, "TradeVolume", values, &result)
+
+	return result, err
+}
+
+// FeeSchedule returns the 30 day volume and the taker and maker fees of the
+// pairs as fractions, keyed by the canonical BASE/QUOTE pair names.
+func (r *RESTClient) FeeSchedule(ctx context.Context, pairs ...string) (float64, map[string]fees.Rates, error) {
+	volume, err := r.TradeVolume(ctx, pairs...)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	rates := make(map[string]fees.Rates, len(volume.Fees))
+
+	for pair, tier := range volume.Fees {
+		// Maker fee defaults to the taker fee if Kraken does not report it
+		rates[canonicalPair(pair)] = fees.Rates{
+			Maker: float64(tier.Fee) / percent,
+			Taker: float64(tier.Fee) / percent,
+		}
+	}
+
+	for pair, tier := range volume.FeesMaker {
+		pair = canonicalPair(pair)
+
+		rate := rates[pair]
+		rate.Maker = float64(tier.Fee) / percent
+		rates[pair] = rate
+	}
+
+	return float64(volume.Volume), rates, nil
+}
+
+// webSocketsToken returns a token for the authenticated websocket and how long
+// it is valid for.
+func (r *RESTClient) webSocketsToken(ctx context.Context) (string, time.Duration, error) {
+	var result struct {
+		Token   string `json:"token"`
+		Expires int    `json:"expires"` // seconds
+	}
+
+	err := r.private(ctx, "GetWebSocketsToken", nil, &result)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return result.Token, time.Duration(result.Expires) * time.Second, nil
+}
+
+// public calls a public endpoint and unmarshals the result into result.
+func (r *RESTClient) public(ctx context.Context, endpoint string, values url.Values, result any) error {
+	endpointURL := r.baseURL + restPublicPath + endpoint
+	if len(values) > 0 {
+		endpointURL += "?" + values.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpointURL, nil)
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+
+	req.Header.Add("Accept", contentApplicationJSON)
+
+	return r.do(req, endpoint, result)
+}
+
+// private calls a private endpoint, signing the request with the client's API
+// key and secret, and unmarshals the result into result.
+func (r *RESTClient) private(ctx context.Context, endpoint string, values url.Values, result any) error {
+	if values == nil {
+		values = url.Values{}
+	}
+
+	values.Set("nonce", strconv.FormatInt(nextNonce(), 10))
+
+	b64DecodedSecret, err := base64.StdEncoding.DecodeString(r.apiSecret)
+	if err != nil {
+		return errors.Wrap(err, "error decoding secret")
+	}
+
+	urlPath := restPrivatePath + endpoint
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.baseURL+urlPath,
+		strings.NewReader(values.Encode()))
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+
+	req.Header.Add("Content-Type", contentURLEncoded)
+	req.Header.Add("Accept", contentApplicationJSON)
+	req.Header.Add("API-Key", r.apiKey)
+	req.Header.Add("API-Sign", getKrakenSignature(urlPath, values, b64DecodedSecret))
+
+	return r.do(req, endpoint, result)
+}
+
+func (r *RESTClient) do(req *http.Request, endpoint string, result any) error {
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error sending request")
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "error reading response body")
+	}
+
+	var unmarshalled restResponse
+
+	err = json.Unmarshal(bodyBytes, &unmarshalled)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling response body")
+	}
+
+	if len(unmarshalled.Error) > 0 {
+		return errors.Wrapf(apiError(unmarshalled.Error[0]), "%s: %s", endpoint,
+			strings.Join(unmarshalled.Error, ", "))
+	}
+
+	err = json.Unmarshal(unmarshalled.Result, result)
+	if err != nil {
+		return errors.Wrapf(err, "error unmarshalling %s result", endpoint)
+	}
+
+	return nil
+}
+
+// nextNonce returns a nonce greater than any returned before. Concurrent calls
+// get distinct nonces, but may still reach Kraken out of order, which needs a
+// nonce window to be configured for the API key.
+func nextNonce() int64 {
+	for {
+		last := lastNonce.Load()
+		next := max(time.Now().UnixMilli(), last+1)
+
+		if lastNonce.CompareAndSwap(last, next) {
+			return next
+		}
+	}
+}
+
+// canonicalPair converts a REST pair name such as XXBTZUSD to BTC/USD. Names
+// that cannot be split are returned as they are.
+func canonicalPair(pair string) string {
+	base, quote, err := symbol.KrakenREST.Pair(pair)
+	if err != nil {
+		return pair
+	}
+
+	return base + "/" + quote
+}
+
+func since(start time.Time) url.Values {
+	values := url.Values{}
+
+	if !start.IsZero() {
+		values.Set("start", strconv.FormatInt(start.Unix(), 10))
+	}
+
+	return values
+}
+
+// apiError maps a Kraken API error message to a typed error.
+func apiError(message string) error {
+	switch {
+	case strings.HasPrefix(message, "EGeneral:Invalid arguments"):
+		return ErrInvalidArguments
+	case strings.HasPrefix(message, "EGeneral:Permission denied"):
+		return ErrPermissionDenied
+	case strings.HasSuffix(message, "Rate limit exceeded"):
+		return ErrRateLimited
+	case strings.HasPrefix(message, "EAPI:Invalid key"),
+		strings.HasPrefix(message, "EAPI:Invalid signature"),
+		strings.HasPrefix(message, "EAPI:Invalid nonce"):
+		return ErrAuthFailed
+	case strings.HasPrefix(message, "EService:"):
+		return ErrMarketUnavailable
+	default:
+		return ErrRequestFailed
+	}
+}
@@ -0,0 +1,125 @@
+package kraken
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func Test_nextNonce(t *testing.T) {
+	const calls = 1000
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		nonces = make(map[int64]struct{}, calls)
+	)
+
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			nonce := nextNonce()
+
+			mu.Lock()
+			nonces[nonce] = struct{}{}
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	if len(nonces) != calls {
+		t.Errorf("nextNonce() returned %d distinct nonces, want %d", len(nonces), calls)
+	}
+
+	if first, second := nextNonce(), nextNonce(); second <= first {
+		t.Errorf("nextNonce() = %d after %d", second, first)
+	}
+}
+
+func TestRESTClient_Balance(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    map[string]float64
+		wantErr error
+	}{
+		{"Balances", `{"error":[],"result":{"ZUSD":"171288.6158","XXBT":"0.0011"}}`,
+			map[string]float64{"ZUSD": 171288.6158, "XXBT": 0.0011}, nil},
+		{"Invalid nonce", `{"error":["EAPI:Invalid nonce"]}`, nil, ErrAuthFailed},
+		{"Rate limited", `{"error":["EAPI:Rate limit exceeded"]}`, nil, ErrRateLimited},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/0/private/Balance" || r.Header.Get("API-Sign") == "" {
+					t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+				}
+
+				if err := r.ParseForm(); err != nil || r.PostForm.Get("nonce") == "" {
+					t.Errorf("request without nonce: %v", err)
+				}
+
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			r := NewRESTClient("key", "c2VjcmV0")
+			r.baseURL = server.URL
+
+			got, err := r.Balance(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Balance() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			for asset, balance := range tt.want {
+				if got[asset] != balance {
+					t.Errorf("Balance() %s = %v, want %v", asset, got[asset], balance)
+				}
+			}
+		})
+	}
+}
+
+func TestRESTClient_FeeSchedule(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"error":[],"result":{"currency":"ZUSD","volume":"60000.0000",
+			"fees":{"XXBTZUSD":{"fee":"0.2400","minfee":"0.1000","maxfee":"0.4000"},
+				"SOLEUR":{"fee":"0.4000","minfee":"0.1000","maxfee":"0.4000"}},
+			"fees_maker":{"XXBTZUSD":{"fee":"0.1400","minfee":"0.0000","maxfee":"0.2500"},
+				"SOLEUR":{"fee":"0.2500","minfee":"0.0000","maxfee":"0.2500"}}}}`))
+	}))
+	defer server.Close()
+
+	r := NewRESTClient("key", "c2VjcmV0")
+	r.baseURL = server.URL
+
+	volume, rates, err := r.FeeSchedule(context.Background(), "XBTUSD", "SOLEUR")
+	if err != nil {
+		t.Fatalf("FeeSchedule() error = %v", err)
+	}
+
+	if volume != 60000 {
+		t.Errorf("FeeSchedule() volume = %v, want 60000", volume)
+	}
+
+	got := rates["BTC/USD"]
+	if math.Abs(got.Maker-0.0014) > 1e-12 || math.Abs(got.Taker-0.0024) > 1e-12 {
+		t.Errorf("FeeSchedule() BTC/USD = %+v", got)
+	}
+
+	// Pairs of assets listed later have no legacy codes
+	got = rates["SOL/EUR"]
+	if math.Abs(got.Maker-0.0025) > 1e-12 || math.Abs(got.Taker-0.004) > 1e-12 {
+		t.Errorf("FeeSchedule() SOL/EUR = %+v", got)
+	}
+}
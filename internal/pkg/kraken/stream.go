@@ -0,0 +1,434 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/peetermeos/tabot/internal/app/prebot"
+	"github.com/peetermeos/tabot/internal/app/tabot"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// inboxSize is how many received messages may wait for slow subscribers
+// before further messages are dropped.
+const inboxSize = 1024
+
+var ErrNotConnected = errors.New("not connected")
+
+// envelope is the common part of every message received from Kraken.
+// Channel messages carry channel, type and data, method responses carry
+// method, req_id, success and either result or error.
+type envelope struct {
+	Channel string          `json:"channel"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+
+	Method  string          `json:"method"`
+	ReqID   int64           `json:"req_id"`
+	Success bool            `json:"success"`
+	Error   string          `json:"error"`
+	Result  json.RawMessage `json:"result"`
+	TimeIn  time.Time       `json:"time_in"`
+	TimeOut time.Time       `json:"time_out"`
+}
+
+// ack returns the method response carried by the envelope.
+func (e envelope) ack() Ack {
+	return Ack{
+		Method:  e.Method,
+		ReqID:   e.ReqID,
+		Success: e.Success,
+		Error:   e.Error,
+		Result:  e.Result,
+		TimeIn:  e.TimeIn,
+		TimeOut: e.TimeOut,
+	}
+}
+
+// tickerData is the L1 exchange rate data from Kraken.
+// Sample:
+//
+//	 {
+//			"channel":"ticker",
+//			"type":"snapshot",
+//			"data":[{
+//				"symbol":"BTC/GBP",
+//				"bid":53975.7,
+//				"bid_qty":0.00282754,
+//				"ask":53975.8,
+//				"ask_qty":2.79487918,
+//				"last":53975.7,
+//				"volume":53.42371402,
+//				"vwap":53299.8,
+//				"low":52499.9,
+//				"high":54357.1,
+//				"change":1095.7,
+//				"change_pct":2.07,
+//			}]
+//		}
+type tickerData struct {
+	Symbol    string  `json:"symbol"`
+	Bid       float64 `json:"bid"`
+	BidQty    float64 `json:"bid_qty"`
+	Ask       float64 `json:"ask"`
+	AskQty    float64 `json:"ask_qty"`
+	Last      float64 `json:"last"`
+	Volume    float64 `json:"volume"`
+	Vwap      float64 `json:"vwap"`
+	Low       float64 `json:"low"`
+	High      float64 `json:"high"`
+	Change    float64 `json:"change"`
+	ChangePct float64 `json:"change_pct"`
+}
+
+// bookData is the L2 order book data from Kraken.
+type bookData struct {
+	Symbol    string       `json:"symbol"`
+	Bids      []Level2Book `json:"bids"`
+	Asks      []Level2Book `json:"asks"`
+	Checksum  uint32       `json:"checksum"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// Trade is a single public trade.
+type Trade struct {
+	Symbol    string    `json:"symbol"`
+	Side      string    `json:"side"`
+	Price     float64   `json:"price"`
+	Qty       float64   `json:"qty"`
+	OrderType string    `json:"ord_type"`
+	TradeID   int64     `json:"trade_id"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Status is the exchange system status, sent on connect and whenever it changes.
+type Status struct {
+	APIVersion   string `json:"api_version"`
+	ConnectionID int64  `json:"connection_id"`
+	System       string `json:"system"`
+	Version      string `json:"version"`
+}
+
+// Ack is a response to a method request such as subscribe.
+type Ack struct {
+	Method  string
+	ReqID   int64
+	Success bool
+	Error   string
+	Result  json.RawMessage
+	TimeIn  time.Time
+	TimeOut time.Time
+}
+
+// Stream returns a channel of ticks from the Kraken websocket.
+// Sample response for BTC/GBP:
+//
+//	ask=53975.8 base=GBP bid=53975.7 instrument=BTC
+func (c *Client) Stream(ctx context.Context) <-chan tabot.Tick {
+	return c.ticks.add(ctx)
+}
+
+// StreamBook returns a channel of order book snapshots and updates.
+func (c *Client) StreamBook(ctx context.Context) <-chan prebot.Book {
+	return c.books.add(ctx)
+}
+
+// StreamTrades returns a channel of public trades.
+func (c *Client) StreamTrades(ctx context.Context) <-chan Trade {
+	return c.trades.add(ctx)
+}
+
+// StreamStatus returns a channel of exchange status updates.
+func (c *Client) StreamStatus(ctx context.Context) <-chan Status {
+	return c.status.add(ctx)
+}
+
+// StreamAcks returns a channel of responses to method requests.
+func (c *Client) StreamAcks(ctx context.Context) <-chan Ack {
+	return c.acks.add(ctx)
+}
+
+// readLoop is the only reader of the websocket connection. It reconnects when
+// the connection drops or stays silent for readTimeout and passes every
+// message on to its subscribers through the inbox, so that subscribers not
+// reading their channels never hold up acknowledgements. All subscriber
+// channels are closed once ctx is done.
+func (c *Client) readLoop(ctx context.Context) {
+	defer close(c.inbox)
+
+	go c.keepalive(ctx)
+	go c.deliverLoop(ctx)
+
+	go func() {
+		<-ctx.Done()
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.conn != nil {
+			err := c.conn.Close()
+			if err != nil {
+				c.logger.WithError(err).Error("error closing websocket connection")
+			}
+		}
+	}()
+
+	for {
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+
+		if conn == nil {
+			err := c.reconnect(ctx, nil, ErrNotConnected)
+			if err != nil {
+				return
+			}
+
+			continue
+		}
+
+		// Every message, heartbeats and pongs included, extends the deadline
+		_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			c.logger.WithError(err).Warn("error reading message from websocket")
+
+			err = c.reconnect(ctx, conn, err)
+			if err != nil {
+				c.logger.WithError(err).Error("error reconnecting")
+
+				return
+			}
+
+			continue
+		}
+
+		c.logger.WithFields(logrus.Fields{
+			"action":  "read_message",
+			"payload": string(payload),
+		}).Debug("received message")
+
+		err = c.receive(payload)
+		if err != nil {
+			c.logger.WithFields(logrus.Fields{
+				"action":  "dispatch_message",
+				"payload": string(payload),
+			}).WithError(err).Error("error dispatching message")
+		}
+	}
+}
+
+// deliverLoop delivers the messages of the inbox to their subscribers until
+// the read loop is done.
+func (c *Client) deliverLoop(ctx context.Context) {
+	defer c.closeStreams()
+
+	for env := range c.inbox {
+		err := c.deliver(ctx, env)
+		if err != nil {
+			c.logger.WithFields(logrus.Fields{
+				"action":  "deliver_message",
+				"channel": env.Channel,
+			}).WithError(err).Error("error delivering message")
+		}
+	}
+}
+
+// receive queues the message for delivery. If the subscribers fall too far
+// behind, market data is dropped. A dropped book message fails the next
+// checksum and resyncs the book. Executions and balances cannot be recovered
+// that way, so they wait for room in the inbox instead.
+func (c *Client) receive(payload []byte) error {
+	env, err := c.parse(payload)
+	if err != nil {
+		return err
+	}
+
+	if env.Channel == channelExecutions || env.Channel == channelBalances {
+		c.inbox <- env
+
+		return nil
+	}
+
+	select {
+	case c.inbox <- env:
+	default:
+		c.logger.WithField("channel", env.Channel).Warn("subscribers not keeping up, dropping message")
+	}
+
+	return nil
+}
+
+// dispatch delivers the message right away.
+func (c *Client) dispatch(ctx context.Context, payload []byte) error {
+	env, err := c.parse(payload)
+	if err != nil {
+		return err
+	}
+
+	return c.deliver(ctx, env)
+}
+
+// parse parses the message envelope and hands a method response to the
+// request waiting for it.
+func (c *Client) parse(payload []byte) (envelope, error) {
+	var env envelope
+
+	err := json.Unmarshal(payload, &env)
+	if err != nil {
+		return env, errors.Wrap(err, "error unmarshalling envelope")
+	}
+
+	if env.Method != "" {
+		c.acknowledge(env.ack())
+	}
+
+	return env, nil
+}
+
+// deliver publishes the content of the message to the subscribers of its
+// channel. Book data is only published once it has been verified against the
+// maintained order book.
+func (c *Client) deliver(ctx context.Context, env envelope) error {
+	var err error
+
+	if env.Method != "" {
+		c.acks.publish(env.ack())
+
+		return nil
+	}
+
+	switch env.Channel {
+	case channelTicker:
+		var data []tickerData
+
+		err = json.Unmarshal(env.Data, &data)
+		if err != nil {
+			return errors.Wrap(err, "error unmarshalling ticker data")
+		}
+
+		for _, item := range data {
+			if !c.delivers(channelTicker, item.Symbol) {
+				continue
+			}
+
+			c.ticks.publish(tabot.Tick{
+				Symbol: item.Symbol,
+				Bid:    item.Bid,
+				BidQty: item.BidQty,
+				Ask:    item.Ask,
+				AskQty: item.AskQty,
+				Time:   time.Now(),
+			})
+		}
+	case channelBook:
+		var data []bookData
+
+		err = json.Unmarshal(env.Data, &data)
+		if err != nil {
+			return errors.Wrap(err, "error unmarshalling book data")
+		}
+
+		for _, item := range data {
+			if !c.delivers(channelBook, item.Symbol) {
+				continue
+			}
+
+			if !c.updateBook(ctx, item, env.Type == "snapshot") {
+				continue
+			}
+
+			c.books.publish(toBook(item, env.Type == "update"))
+		}
+	case channelTrade:
+		var data []Trade
+
+		err = json.Unmarshal(env.Data, &data)
+		if err != nil {
+			return errors.Wrap(err, "error unmarshalling trade data")
+		}
+
+		for _, item := range data {
+			if !c.delivers(channelTrade, item.Symbol) {
+				continue
+			}
+
+			c.trades.publish(item)
+		}
+	case channelStatus:
+		var data []Status
+
+		err = json.Unmarshal(env.Data, &data)
+		if err != nil {
+			return errors.Wrap(err, "error unmarshalling status data")
+		}
+
+		for _, item := range data {
+			c.status.publish(item)
+		}
+	case channelExecutions:
+		if !c.delivers(channelExecutions, "") {
+			return nil
+		}
+
+		return c.dispatchExecutions(env.Data)
+	case channelBalances:
+		if !c.delivers(channelBalances, "") {
+			return nil
+		}
+
+		return c.dispatchBalances(env.Data, env.Type == "snapshot")
+	case channelInstrument:
+		if !c.delivers(channelInstrument, "") {
+			return nil
+		}
+
+		return c.dispatchInstruments(env.Data)
+	case channelHeartbeat:
+	default:
+		c.logger.WithField("channel", env.Channel).Debug("ignoring message from unknown channel")
+	}
+
+	return nil
+}
+
+func (c *Client) closeStreams() {
+	c.ticks.close()
+	c.books.close()
+	c.trades.close()
+	c.status.close()
+	c.acks.close()
+	c.fills.close()
+	c.orders.close()
+	c.balanceChanges.close()
+}
+
+func toBook(data bookData, isUpdate bool) prebot.Book {
+	item := prebot.Book{
+		Symbol:   data.Symbol,
+		IsUpdate: isUpdate,
+	}
+
+	for _, bid := range data.Bids {
+		item.Bids = append(item.Bids, prebot.Level2Book{
+			Price:  bid.Price,
+			Volume: bid.Qty,
+		})
+	}
+
+	for _, ask := range data.Asks {
+		item.Asks = append(item.Asks, prebot.Level2Book{
+			Price:  ask.Price,
+			Volume: ask.Qty,
+		})
+	}
+
+	return item
+}
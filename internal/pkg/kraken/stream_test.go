@@ -0,0 +1,263 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/peetermeos/tabot/internal/app/prebot"
+	"github.com/peetermeos/tabot/internal/app/tabot"
+	"github.com/peetermeos/tabot/internal/pkg/instrument"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestClient() *Client {
+	return &Client{
+		logger:        logrus.New(),
+		subscriptions: make(map[subscription]SubscriptionState),
+		events:        make(chan ConnectionEvent, eventBufferSize),
+		pending:       make(map[int64]chan Ack),
+		orderBooks:    make(map[string]*localBook),
+		inbox:         make(chan envelope, inboxSize),
+		instruments:   instrument.NewRegistry(),
+		ticks:         newFanout[tabot.Tick](),
+		books:         newFanout[prebot.Book](),
+		trades:        newFanout[Trade](),
+		status:        newFanout[Status](),
+		acks:          newFanout[Ack](),
+
+		fills:          newFanout[Fill](),
+		orders:         newFanout[OrderStatus](),
+		balanceChanges: newFanout[BalanceChange](),
+	}
+}
+
+// wsServer stands in for the Kraken websocket. Every connection the client
+// opens is handed to the test, which plays the exchange's side of it.
+type wsServer struct {
+	*httptest.Server
+	conns chan *websocket.Conn
+}
+
+func newWSServer(t *testing.T) *wsServer {
+	t.Helper()
+
+	s := &wsServer{conns: make(chan *websocket.Conn, 4)}
+
+	upgrader := websocket.Upgrader{}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade() error = %v", err)
+
+			return
+		}
+
+		s.conns <- conn
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// accept returns the next connection the client opened.
+func (s *wsServer) accept(t *testing.T) *websocket.Conn {
+	t.Helper()
+
+	select {
+	case conn := <-s.conns:
+		t.Cleanup(func() { _ = conn.Close() })
+
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not connect")
+
+		return nil
+	}
+}
+
+// testRequest is a method request as the server receives it.
+type testRequest struct {
+	Method string                 `json:"method"`
+	Params websocketRequestParams `json:"params"`
+	ReqID  int64                  `json:"req_id"`
+}
+
+// receive reads the next request from the client, skipping pings.
+func receive(t *testing.T, conn *websocket.Conn) testRequest {
+	t.Helper()
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		var req testRequest
+
+		err := conn.ReadJSON(&req)
+		if err != nil {
+			t.Fatalf("ReadJSON() error = %v", err)
+		}
+
+		if req.Method != methodPing {
+			return req
+		}
+	}
+}
+
+// reply acknowledges the request, failing it with the error if there is one.
+func reply(t *testing.T, conn *websocket.Conn, req testRequest, errMsg string) {
+	t.Helper()
+
+	result, _ := json.Marshal(subscriptionResult{Channel: req.Params.Channel, Symbol: req.Params.Symbol[0]})
+
+	err := conn.WriteJSON(envelope{
+		Method:  req.Method,
+		ReqID:   req.ReqID,
+		Success: errMsg == "",
+		Error:   errMsg,
+		Result:  result,
+	})
+	if err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+}
+
+// newConnectedClient creates a client connected to the server with its read
+// loop running until ctx is done.
+func newConnectedClient(ctx context.Context, t *testing.T, server *wsServer) *Client {
+	t.Helper()
+
+	c := newTestClient()
+	c.endpoint = "ws" + strings.TrimPrefix(server.URL, "http")
+	c.tokenExpiry = time.Now().Add(time.Hour)
+
+	c.mu.Lock()
+	err := c.connect(ctx)
+	c.mu.Unlock()
+
+	if err != nil {
+		t.Fatalf("connect() error = %v", err)
+	}
+
+	go c.readLoop(ctx)
+
+	return c
+}
+
+func TestClient_dispatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := newTestClient()
+	c.subscriptions[subscription{channel: channelTicker, symbol: "BTC/GBP"}] = SubscriptionActive
+	c.subscriptions[subscription{channel: channelBook, symbol: "BTC/GBP"}] = SubscriptionUnsubscribing
+	c.subscriptions[subscription{channel: channelBook, symbol: "ETH/GBP"}] = SubscriptionPending
+
+	ticks := c.Stream(ctx)
+	books := c.StreamBook(ctx)
+	acks := c.StreamAcks(ctx)
+
+	payloads := []string{
+		`{"channel":"ticker","type":"snapshot","data":[{"symbol":"BTC/GBP","bid":53975.7,"ask":53975.8}]}`,
+		`{"channel":"book","type":"update","data":[{"symbol":"BTC/GBP","bids":[{"price":53975.7,"qty":2.5}],"asks":[]}]}`,
+		`{"channel":"book","type":"snapshot","data":[{"symbol":"ETH/GBP","bids":[{"price":2975.7,"qty":1.5}],"asks":[],"checksum":3839582689}]}`,
+		`{"method":"subscribe","req_id":7,"success":true,"result":{"channel":"book","symbol":"ETH/GBP"}}`,
+	}
+
+	go func() {
+		for _, payload := range payloads {
+			if err := c.dispatch(ctx, []byte(payload)); err != nil {
+				t.Errorf("dispatch() error = %v", err)
+			}
+		}
+	}()
+
+	tick := <-ticks
+	if tick.Symbol != "BTC/GBP" || tick.Bid != 53975.7 || tick.Ask != 53975.8 || tick.Time.IsZero() {
+		t.Errorf("Stream() got = %+v", tick)
+	}
+
+	book := <-books
+	if book.Symbol != "ETH/GBP" || book.IsUpdate || len(book.Bids) != 1 || book.Bids[0].Volume != 1.5 {
+		t.Errorf("StreamBook() got = %+v", book)
+	}
+
+	ack := <-acks
+	if ack.ReqID != 7 || !ack.Success {
+		t.Errorf("StreamAcks() got = %+v", ack)
+	}
+
+	want := []Subscription{
+		{Channel: channelBook, Symbol: "BTC/GBP", State: SubscriptionUnsubscribing},
+		{Channel: channelBook, Symbol: "ETH/GBP", State: SubscriptionActive},
+		{Channel: channelTicker, Symbol: "BTC/GBP", State: SubscriptionActive},
+	}
+
+	if got := c.Subscriptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Subscriptions() got = %v, want %v", got, want)
+	}
+}
+
+func TestClient_receive_full(t *testing.T) {
+	c := newTestClient()
+
+	for len(c.inbox) < cap(c.inbox) {
+		if err := c.receive([]byte(`{"channel":"ticker","type":"update","data":[]}`)); err != nil {
+			t.Fatalf("receive() error = %v", err)
+		}
+	}
+
+	// Market data is dropped once the inbox is full
+	if err := c.receive([]byte(`{"channel":"book","type":"update","data":[]}`)); err != nil {
+		t.Fatalf("receive() error = %v", err)
+	}
+
+	received := make(chan error, 1)
+
+	go func() {
+		received <- c.receive([]byte(`{"channel":"executions","type":"update","data":[]}`))
+	}()
+
+	select {
+	case err := <-received:
+		t.Fatalf("receive() of an execution returned %v with the inbox full", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-c.inbox
+
+	if err := <-received; err != nil {
+		t.Fatalf("receive() error = %v", err)
+	}
+
+	channels := make(map[string]int)
+	for len(c.inbox) > 0 {
+		channels[(<-c.inbox).Channel]++
+	}
+
+	if channels[channelBook] != 0 || channels[channelExecutions] != 1 {
+		t.Errorf("inbox = %v, want the execution and no book message", channels)
+	}
+}
+
+func TestClient_closeStreams(t *testing.T) {
+	c := newTestClient()
+	ticks := c.Stream(context.Background())
+
+	c.closeStreams()
+
+	if _, ok := <-ticks; ok {
+		t.Error("Stream() channel not closed")
+	}
+
+	if _, ok := <-c.Stream(context.Background()); ok {
+		t.Error("Stream() after close returned an open channel")
+	}
+}
@@ -0,0 +1,414 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	methodSubscribe   = "subscribe"
+	methodUnsubscribe = "unsubscribe"
+
+	ackTimeout = 10 * time.Second
+)
+
+var (
+	ErrNotSubscribed     = errors.New("not subscribed")
+	ErrAlreadySubscribed = errors.New("already subscribed")
+	ErrUnknownSymbol     = errors.New("unknown symbol")
+	ErrRateLimited       = errors.New("rate limited")
+	ErrRequestFailed     = errors.New("request failed")
+)
+
+// SubscriptionState is the state of a single channel subscription.
+type SubscriptionState int
+
+const (
+	// SubscriptionPending means the subscribe request has been sent, but not
+	// acknowledged yet.
+	SubscriptionPending SubscriptionState = iota
+	// SubscriptionActive means Kraken has acknowledged the subscription.
+	SubscriptionActive
+	// SubscriptionUnsubscribing means the unsubscribe request has been sent.
+	// No more data is delivered for the subscription.
+	SubscriptionUnsubscribing
+)
+
+func (s SubscriptionState) String() string {
+	switch s {
+	case SubscriptionPending:
+		return "pending"
+	case SubscriptionActive:
+		return "active"
+	case SubscriptionUnsubscribing:
+		return "unsubscribing"
+	default:
+		return "unknown"
+	}
+}
+
+// Subscription describes a channel subscription held by the client.
+type Subscription struct {
+	Channel string
+	Symbol  string
+	State   SubscriptionState
+}
+
+// subscription identifies a single channel subscription for a symbol.
+type subscription struct {
+	channel string
+	symbol  string
+}
+
+// private reports whether the channel requires an auth token.
+func (s subscription) private() bool {
+	return s.channel == channelExecutions || s.channel == channelBalances
+}
+
+func (s subscription) params(token string) websocketRequestParams {
+	params := websocketRequestParams{Channel: s.channel}
+
+	if s.symbol != "" {
+		params.Symbol = []string{s.symbol}
+	}
+
+	if s.private() {
+		params.Token = token
+	}
+
+	return params
+}
+
+// subscriptionResult is the result of a successful subscribe or unsubscribe.
+type subscriptionResult struct {
+	Channel string `json:"channel"`
+	Symbol  string `json:"symbol"`
+}
+
+func (c *Client) Subscribe(ctx context.Context, symbol string) error {
+	return c.subscribe(ctx, subscription{channel: channelTicker, symbol: symbol})
+}
+
+func (c *Client) Unsubscribe(ctx context.Context, symbol string) error {
+	return c.unsubscribe(ctx, subscription{channel: channelTicker, symbol: symbol})
+}
+
+func (c *Client) SubscribeBook(ctx context.Context, symbol string) error {
+	return c.subscribe(ctx, subscription{channel: channelBook, symbol: symbol})
+}
+
+func (c *Client) UnsubscribeBook(ctx context.Context, symbol string) error {
+	return c.unsubscribe(ctx, subscription{channel: channelBook, symbol: symbol})
+}
+
+func (c *Client) SubscribeTrades(ctx context.Context, symbol string) error {
+	return c.subscribe(ctx, subscription{channel: channelTrade, symbol: symbol})
+}
+
+func (c *Client) UnsubscribeTrades(ctx context.Context, symbol string) error {
+	return c.unsubscribe(ctx, subscription{channel: channelTrade, symbol: symbol})
+}
+
+// Subscriptions lists all subscriptions held by the client, ordered by channel
+// and symbol.
+func (c *Client) Subscriptions() []Subscription {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	subs := make([]Subscription, 0, len(c.subscriptions))
+
+	for sub, state := range c.subscriptions {
+		subs = append(subs, Subscription{
+			Channel: sub.channel,
+			Symbol:  sub.symbol,
+			State:   state,
+		})
+	}
+
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].Channel != subs[j].Channel {
+			return subs[i].Channel < subs[j].Channel
+		}
+
+		return subs[i].Symbol < subs[j].Symbol
+	})
+
+	return subs
+}
+
+// subscribe sends a subscription request and waits for its acknowledgement.
+// The subscription is recorded, so that it can be replayed after a reconnect.
+// If ctx has no deadline, the wait is limited to ackTimeout. Only a rejection
+// drops the subscription: when the request could not be sent or its answer
+// did not arrive in time, it stays pending, to be activated by a late
+// acknowledgement or replayed by the next reconnect.
+func (c *Client) subscribe(ctx context.Context, sub subscription) error {
+	c.mu.Lock()
+
+	state, ok := c.subscriptions[sub]
+	if ok && state == SubscriptionActive {
+		c.mu.Unlock()
+
+		return errors.Wrapf(ErrAlreadySubscribed, "%s %s", sub.channel, sub.symbol)
+	}
+
+	c.subscriptions[sub] = SubscriptionPending
+	c.mu.Unlock()
+
+	ack, err := c.request(ctx, methodSubscribe, sub)
+	if err != nil && !errors.Is(err, ErrAlreadySubscribed) {
+		if !rejected(ack) {
+			return err
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if state, ok := c.subscriptions[sub]; ok && state == SubscriptionPending {
+			delete(c.subscriptions, sub)
+		}
+
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.subscriptions[sub]; ok {
+		c.subscriptions[sub] = SubscriptionActive
+	}
+
+	return err
+}
+
+// unsubscribe sends an unsubscribe request and waits for its acknowledgement.
+// Data for the subscription is no longer delivered as soon as the request is
+// sent. A rejected request restores the subscription, one left unanswered
+// keeps unsubscribing until a late acknowledgement or the next reconnect
+// drops it.
+func (c *Client) unsubscribe(ctx context.Context, sub subscription) error {
+	c.mu.Lock()
+
+	state, ok := c.subscriptions[sub]
+	if !ok || state == SubscriptionUnsubscribing {
+		c.mu.Unlock()
+
+		return errors.Wrapf(ErrNotSubscribed, "%s %s", sub.channel, sub.symbol)
+	}
+
+	c.subscriptions[sub] = SubscriptionUnsubscribing
+	c.mu.Unlock()
+
+	ack, err := c.request(ctx, methodUnsubscribe, sub)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.subscriptions[sub] != SubscriptionUnsubscribing {
+		// Dropped by a reconnect in the meantime, nothing left to unsubscribe.
+		return nil
+	}
+
+	if err != nil && !errors.Is(err, ErrNotSubscribed) {
+		if rejected(ack) {
+			c.subscriptions[sub] = state
+		}
+
+		return err
+	}
+
+	delete(c.subscriptions, sub)
+
+	return nil
+}
+
+// rejected reports whether Kraken answered the request and refused it.
+func rejected(ack Ack) bool {
+	return ack.Method != "" && !ack.Success
+}
+
+// request sends a method request for sub and waits for its acknowledgement.
+// A failed request is reported as a typed error.
+func (c *Client) request(ctx context.Context, method string, sub subscription) (Ack, error) {
+	var token string
+
+	if sub.private() {
+		var err error
+
+		token, err = c.authToken(ctx)
+		if err != nil {
+			return Ack{}, err
+		}
+	}
+
+	ack, err := c.call(ctx, method, sub.params(token))
+	if err != nil {
+		return ack, err
+	}
+
+	if !ack.Success {
+		return ack, errors.Wrapf(ackError(ack), "%s %s %s: %s", method, sub.channel, sub.symbol, ack.Error)
+	}
+
+	return ack, nil
+}
+
+// call sends a method request and waits until Kraken acknowledges it or ctx
+// is done. If ctx has no deadline, the wait is limited to ackTimeout. It is up
+// to the caller to check whether the request succeeded.
+func (c *Client) call(ctx context.Context, method string, params any) (Ack, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, ackTimeout)
+		defer cancel()
+	}
+
+	reqID := c.reqID.Add(1)
+	ackCh := make(chan Ack, 1)
+
+	c.pendingMu.Lock()
+	c.pending[reqID] = ackCh
+	c.pendingMu.Unlock()
+
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, reqID)
+		c.pendingMu.Unlock()
+	}()
+
+	err := c.write(method, params, reqID)
+	if err != nil {
+		return Ack{}, err
+	}
+
+	select {
+	case ack := <-ackCh:
+		return ack, nil
+	case <-ctx.Done():
+		return Ack{}, errors.Wrapf(ctx.Err(), "waiting for %s acknowledgement", method)
+	}
+}
+
+// write sends a method request on the current connection. Connecting is left
+// to the read loop, which replays the subscriptions once it has reconnected.
+func (c *Client) write(method string, params any, reqID int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+
+	return c.send(method, params, reqID)
+}
+
+// send writes a method request to the current connection.
+// The caller must hold c.mu.
+func (c *Client) send(method string, params any, reqID int64) error {
+	req := websocketRequest{
+		Method: method,
+		Params: params,
+		ReqID:  reqID,
+	}
+
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling request")
+	}
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	err = c.conn.WriteMessage(websocket.TextMessage, reqBody)
+	if err != nil {
+		return errors.Wrap(err, "error writing message to websocket")
+	}
+
+	return nil
+}
+
+// acknowledge hands the method response to the request waiting for it and
+// updates the subscription registry, also for requests no longer waiting.
+func (c *Client) acknowledge(ack Ack) {
+	c.pendingMu.Lock()
+	ackCh, ok := c.pending[ack.ReqID]
+	c.pendingMu.Unlock()
+
+	if ok {
+		ackCh <- ack
+	}
+
+	if !ack.Success && !ok {
+		// Nobody is waiting for it, e.g. a resubscription after reconnect.
+		c.logger.WithFields(logrus.Fields{
+			"method": ack.Method,
+			"req_id": ack.ReqID,
+		}).WithError(errors.Wrap(ackError(ack), ack.Error)).Warn("request failed")
+	}
+
+	if (ack.Method != methodSubscribe && ack.Method != methodUnsubscribe) || !ack.Success {
+		return
+	}
+
+	var result subscriptionResult
+
+	err := json.Unmarshal(ack.Result, &result)
+	if err != nil {
+		c.logger.WithFields(logrus.Fields{
+			"method": ack.Method,
+			"req_id": ack.ReqID,
+		}).WithError(err).Error("error unmarshalling subscription result")
+
+		return
+	}
+
+	sub := subscription{channel: result.Channel, symbol: result.Symbol}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, ok := c.subscriptions[sub]
+
+	switch {
+	case ok && ack.Method == methodSubscribe && state == SubscriptionPending:
+		c.subscriptions[sub] = SubscriptionActive
+	case ok && ack.Method == methodUnsubscribe && state == SubscriptionUnsubscribing:
+		delete(c.subscriptions, sub)
+	}
+}
+
+// delivers reports whether data for the given channel and symbol should be
+// delivered to subscribers.
+func (c *Client) delivers(channel, symbol string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, ok := c.subscriptions[subscription{channel: channel, symbol: symbol}]
+
+	return ok && state != SubscriptionUnsubscribing
+}
+
+// ackError maps the error message of a failed method response to a typed error.
+func ackError(ack Ack) error {
+	switch {
+	case strings.Contains(ack.Error, "Currency pair not"):
+		// "Currency pair not supported" and "Currency pair not in ISO 4217-A3 format"
+		return ErrUnknownSymbol
+	case strings.Contains(ack.Error, "Already subscribed"):
+		return ErrAlreadySubscribed
+	case strings.Contains(ack.Error, "Subscription Not Found"):
+		return ErrNotSubscribed
+	case strings.Contains(ack.Error, "Exceeded msg rate"),
+		strings.Contains(ack.Error, "Rate limit exceeded"):
+		return ErrRateLimited
+	default:
+		return ErrRequestFailed
+	}
+}
@@ -0,0 +1,235 @@
+package kraken
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+func Test_ackError(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    error
+	}{
+		{"Unknown pair", "Currency pair not supported BTX/USD", ErrUnknownSymbol},
+		{"Bad format", "Currency pair not in ISO 4217-A3 format BTXUSD", ErrUnknownSymbol},
+		{"Already subscribed", "Already subscribed", ErrAlreadySubscribed},
+		{"Not subscribed", "Subscription Not Found", ErrNotSubscribed},
+		{"Rate limited", "Exceeded msg rate", ErrRateLimited},
+		{"Other", "Malformed request", ErrRequestFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ackError(Ack{Error: tt.message}); !errors.Is(got, tt.want) {
+				t.Errorf("ackError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_subscribe_unreadStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := newWSServer(t)
+	c := newConnectedClient(ctx, t, server)
+	conn := server.accept(t)
+
+	// Nobody reads the ticks until all pairs are subscribed
+	ticks := c.Stream(ctx)
+
+	for _, symbol := range []string{"BTC/USD", "ETH/USD", "ETH/BTC"} {
+		subscribed := make(chan error)
+
+		go func() {
+			subCtx, subCancel := context.WithTimeout(ctx, 2*time.Second)
+			defer subCancel()
+
+			subscribed <- c.Subscribe(subCtx, symbol)
+		}()
+
+		reply(t, conn, receive(t, conn), "")
+
+		err := conn.WriteMessage(websocket.TextMessage,
+			[]byte(`{"channel":"ticker","type":"update","data":[{"symbol":"`+symbol+`","bid":1,"ask":2}]}`))
+		if err != nil {
+			t.Fatalf("WriteMessage() error = %v", err)
+		}
+
+		if err := <-subscribed; err != nil {
+			t.Fatalf("Subscribe(%s) error = %v", symbol, err)
+		}
+	}
+
+	for _, want := range []string{"BTC/USD", "ETH/USD", "ETH/BTC"} {
+		if tick := <-ticks; tick.Symbol != want {
+			t.Errorf("Stream() got %s, want %s", tick.Symbol, want)
+		}
+	}
+
+	want := []Subscription{
+		{Channel: channelTicker, Symbol: "BTC/USD", State: SubscriptionActive},
+		{Channel: channelTicker, Symbol: "ETH/BTC", State: SubscriptionActive},
+		{Channel: channelTicker, Symbol: "ETH/USD", State: SubscriptionActive},
+	}
+
+	if got := c.Subscriptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Subscriptions() got = %v, want %v", got, want)
+	}
+}
+
+func TestClient_subscriptions(t *testing.T) {
+	active := SubscriptionActive
+
+	tests := []struct {
+		name      string
+		initial   *SubscriptionState
+		method    string
+		answer    string // ack, reject, late or none
+		rejection string
+		wantErr   error
+		want      []Subscription
+		wantLate  []Subscription
+	}{
+		{
+			name:   "Subscribe acknowledged",
+			method: methodSubscribe,
+			answer: "ack",
+			want:   []Subscription{{Channel: channelTicker, Symbol: "BTC/USD", State: SubscriptionActive}},
+		},
+		{
+			name:      "Subscribe rejected",
+			method:    methodSubscribe,
+			answer:    "reject",
+			rejection: "Currency pair not supported BTC/USD",
+			wantErr:   ErrUnknownSymbol,
+			want:      []Subscription{},
+		},
+		{
+			name:     "Subscribe acknowledged late",
+			method:   methodSubscribe,
+			answer:   "late",
+			wantErr:  context.DeadlineExceeded,
+			want:     []Subscription{{Channel: channelTicker, Symbol: "BTC/USD", State: SubscriptionPending}},
+			wantLate: []Subscription{{Channel: channelTicker, Symbol: "BTC/USD", State: SubscriptionActive}},
+		},
+		{
+			name:    "Subscribe twice",
+			initial: &active,
+			method:  methodSubscribe,
+			answer:  "none",
+			wantErr: ErrAlreadySubscribed,
+			want:    []Subscription{{Channel: channelTicker, Symbol: "BTC/USD", State: SubscriptionActive}},
+		},
+		{
+			name:    "Unsubscribe acknowledged",
+			initial: &active,
+			method:  methodUnsubscribe,
+			answer:  "ack",
+			want:    []Subscription{},
+		},
+		{
+			name:      "Unsubscribe rejected",
+			initial:   &active,
+			method:    methodUnsubscribe,
+			answer:    "reject",
+			rejection: "Malformed request",
+			wantErr:   ErrRequestFailed,
+			want:      []Subscription{{Channel: channelTicker, Symbol: "BTC/USD", State: SubscriptionActive}},
+		},
+		{
+			name:     "Unsubscribe acknowledged late",
+			initial:  &active,
+			method:   methodUnsubscribe,
+			answer:   "late",
+			wantErr:  context.DeadlineExceeded,
+			want:     []Subscription{{Channel: channelTicker, Symbol: "BTC/USD", State: SubscriptionUnsubscribing}},
+			wantLate: []Subscription{},
+		},
+		{
+			name:    "Unsubscribe without subscription",
+			method:  methodUnsubscribe,
+			answer:  "none",
+			wantErr: ErrNotSubscribed,
+			want:    []Subscription{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			server := newWSServer(t)
+			c := newConnectedClient(ctx, t, server)
+			conn := server.accept(t)
+
+			if tt.initial != nil {
+				c.mu.Lock()
+				c.subscriptions[subscription{channel: channelTicker, symbol: "BTC/USD"}] = *tt.initial
+				c.mu.Unlock()
+			}
+
+			call := c.Subscribe
+			if tt.method == methodUnsubscribe {
+				call = c.Unsubscribe
+			}
+
+			done := make(chan error, 1)
+
+			go func() {
+				callCtx, callCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+				defer callCancel()
+
+				done <- call(callCtx, "BTC/USD")
+			}()
+
+			var req testRequest
+
+			if tt.answer != "none" {
+				req = receive(t, conn)
+				if req.Method != tt.method || req.Params.Channel != channelTicker || req.Params.Symbol[0] != "BTC/USD" {
+					t.Fatalf("request = %+v", req)
+				}
+			}
+
+			switch tt.answer {
+			case "ack":
+				reply(t, conn, req, "")
+			case "reject":
+				reply(t, conn, req, tt.rejection)
+			}
+
+			if err := <-done; !errors.Is(err, tt.wantErr) {
+				t.Fatalf("%s error = %v, want %v", tt.method, err, tt.wantErr)
+			}
+
+			if got := c.Subscriptions(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Subscriptions() got = %v, want %v", got, tt.want)
+			}
+
+			if tt.answer != "late" {
+				return
+			}
+
+			reply(t, conn, req, "")
+
+			for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+				got := c.Subscriptions()
+				if reflect.DeepEqual(got, tt.wantLate) {
+					break
+				}
+
+				if time.Now().After(deadline) {
+					t.Fatalf("Subscriptions() after late ack got = %v, want %v", got, tt.wantLate)
+				}
+			}
+		})
+	}
+}
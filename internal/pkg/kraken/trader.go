@@ -0,0 +1,461 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/peetermeos/tabot/internal/app/tabot"
+	"github.com/peetermeos/tabot/internal/pkg/instrument"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	methodAddOrder    = "add_order"
+	methodAmendOrder  = "amend_order"
+	methodCancelOrder = "cancel_order"
+	methodCancelAll   = "cancel_all"
+
+	OrderTypeLimit  = "limit"
+	OrderTypeMarket = "market"
+
+	SideBuy  = "buy"
+	SideSell = "sell"
+
+	timeInForceIOC = "ioc"
+)
+
+// closedStatuses are the statuses of orders that do not fill any further.
+var closedStatuses = map[string]bool{
+	"filled":   true,
+	"canceled": true,
+	"expired":  true,
+}
+
+var (
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrOrderMinimum      = errors.New("order minimum not met")
+	ErrUnknownOrder      = errors.New("unknown order")
+	ErrInvalidArguments  = errors.New("invalid arguments")
+	ErrPermissionDenied  = errors.New("permission denied")
+	ErrMarketUnavailable = errors.New("market unavailable")
+	ErrOrderRejected     = errors.New("order rejected")
+	ErrOrderNotFilled    = errors.New("order not filled")
+	ErrStreamClosed      = errors.New("execution stream closed")
+)
+
+// OrderRequest describes a new order. LimitPrice is ignored for market orders.
+type OrderRequest struct {
+	Symbol        string
+	Side          string
+	Type          string
+	Qty           float64
+	LimitPrice    float64
+	TimeInForce   string // gtc, ioc or gtd, Kraken defaults to gtc
+	PostOnly      bool
+	ClientOrderID string
+}
+
+// AmendRequest describes a change to an open order, zero values are left
+// unchanged.
+type AmendRequest struct {
+	OrderID    string
+	Qty        float64
+	LimitPrice float64
+}
+
+type addOrderParams struct {
+	OrderType     string  `json:"order_type"`
+	Side          string  `json:"side"`
+	OrderQty      float64 `json:"order_qty"`
+	Symbol        string  `json:"symbol"`
+	LimitPrice    float64 `json:"limit_price,omitempty"`
+	TimeInForce   string  `json:"time_in_force,omitempty"`
+	PostOnly      bool    `json:"post_only,omitempty"`
+	ClientOrderID string  `json:"cl_ord_id,omitempty"`
+	Token         string  `json:"token"`
+}
+
+type amendOrderParams struct {
+	OrderID    string  `json:"order_id"`
+	OrderQty   float64 `json:"order_qty,omitempty"`
+	LimitPrice float64 `json:"limit_price,omitempty"`
+	Token      string  `json:"token"`
+}
+
+type cancelOrderParams struct {
+	OrderID []string `json:"order_id"`
+	Token   string   `json:"token"`
+}
+
+type tokenParams struct {
+	Token string `json:"token"`
+}
+
+type addOrderResult struct {
+	OrderID       string `json:"order_id"`
+	ClientOrderID string `json:"cl_ord_id"`
+}
+
+type cancelAllResult struct {
+	Count int `json:"count"`
+}
+
+// Trader places orders through the authenticated Kraken websocket.
+// It implements the execution provider of the bots.
+type Trader struct {
+	logger logrus.FieldLogger
+	client *Client
+	base   string
+
+	balancesMu sync.Mutex
+	balances   map[string]float64
+}
+
+// NewTrader connects to the authenticated websocket. Balances are tracked once
+// subscribed to, TotalCapital reports the balance of the base asset.
+func NewTrader(ctx context.Context, logger logrus.FieldLogger, apiKey, apiSecret, base string) *Trader {
+	logger = logger.WithField("comp", "kraken-trader")
+
+	t := &Trader{
+		logger:   logger,
+		client:   newClient(ctx, logger, krakenWsAuthURL, apiKey, apiSecret),
+		base:     base,
+		balances: make(map[string]float64),
+	}
+
+	go t.trackBalances(ctx)
+
+	return t
+}
+
+// Execute places the order described by input, a limit order at input.Rate
+// or a market order if the rate is not set, and waits until it no longer
+// fills. It requires the executions subscription. The fills are returned even
+// if the order was cancelled before filling in full.
+func (t *Trader) Execute(ctx context.Context, input tabot.ExecutionInput) (tabot.ExecutionResult, error) {
+	req := OrderRequest{
+		Symbol:     fmt.Sprintf("%s/%s", input.Symbol, input.Base),
+		Side:       input.Side,
+		Type:       OrderTypeMarket,
+		Qty:        input.Qty,
+		LimitPrice: input.Rate,
+	}
+
+	if input.Rate > 0 {
+		req.Type = OrderTypeLimit
+
+		if input.ImmediateOrCancel {
+			req.TimeInForce = timeInForceIOC
+		}
+	}
+
+	// Executions may arrive before the order is acknowledged, so they are
+	// collected from before it is placed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	fills := t.StreamFills(ctx)
+	orders := t.StreamOrders(ctx)
+	placed := make(chan string, 1)
+	done := make(chan execution, 1)
+
+	go func() {
+		result, err := await(ctx, placed, fills, orders)
+		done <- execution{result: result, err: err}
+	}()
+
+	orderID, err := t.AddOrder(ctx, req)
+	if err != nil {
+		return tabot.ExecutionResult{}, err
+	}
+
+	t.logger.WithFields(logrus.Fields{
+		"order_id": orderID,
+		"symbol":   req.Symbol,
+		"side":     req.Side,
+		"qty":      req.Qty,
+		"price":    req.LimitPrice,
+	}).Info("order placed")
+
+	placed <- orderID
+	executed := <-done
+
+	return executed.result, executed.err
+}
+
+// execution is the outcome of an order awaited by Execute.
+type execution struct {
+	result tabot.ExecutionResult
+	err    error
+}
+
+// await collects fills until the order, whose ID is sent on placed, is
+// closed, and returns their total. If ctx is done or the streams close first,
+// the fills received so far are returned along with the error, so that a
+// partly filled order is not taken for an unfilled one.
+func await(ctx context.Context, placed <-chan string, fills <-chan Fill, orders <-chan OrderStatus) (tabot.ExecutionResult, error) {
+	var (
+		orderID  string
+		received []Fill
+	)
+
+	closed := make(map[string]string)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return partial(orderID, received), ctx.Err()
+		case orderID = <-placed:
+			placed = nil
+		case fill, ok := <-fills:
+			if !ok {
+				return partial(orderID, received), ErrStreamClosed
+			}
+
+			received = append(received, fill)
+		case status, ok := <-orders:
+			if !ok {
+				return partial(orderID, received), ErrStreamClosed
+			}
+
+			if closedStatuses[status.Status] {
+				closed[status.OrderID] = status.Status
+			}
+		}
+
+		status, ok := closed[orderID]
+		if orderID == "" || !ok {
+			continue
+		}
+
+		return total(orderID, status, received)
+	}
+}
+
+// partial sums up the fills the order received before it was closed.
+func partial(orderID string, fills []Fill) tabot.ExecutionResult {
+	result, _ := total(orderID, "open", fills)
+
+	return result
+}
+
+// total sums up the fills of the order at their average price.
+func total(orderID, status string, fills []Fill) (tabot.ExecutionResult, error) {
+	var (
+		result tabot.ExecutionResult
+		cost   float64
+	)
+
+	for _, fill := range fills {
+		if fill.OrderID != orderID {
+			continue
+		}
+
+		result.Qty += fill.Qty
+		result.Fee += fill.Fee
+		result.FeeAsset = fill.FeeAsset
+		cost += fill.Qty * fill.Price
+	}
+
+	if result.Qty <= 0 {
+		return result, errors.Wrapf(ErrOrderNotFilled, "%s %s", orderID, status)
+	}
+
+	result.Price = cost / result.Qty
+
+	return result, nil
+}
+
+// TotalCapital returns the last known balance of the base asset.
+func (t *Trader) TotalCapital() float64 {
+	t.balancesMu.Lock()
+	defer t.balancesMu.Unlock()
+
+	return t.balances[t.base]
+}
+
+// AddOrder places a new order and returns its exchange order ID. Once the
+// pair metadata is known, the quantity and limit price are rounded to the
+// pair increments and orders below the pair minimums are rejected without
+// reaching the exchange.
+func (t *Trader) AddOrder(ctx context.Context, req OrderRequest) (string, error) {
+	req, err := t.normalize(req)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := t.client.authToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := addOrderParams{
+		OrderType:     req.Type,
+		Side:          req.Side,
+		OrderQty:      req.Qty,
+		Symbol:        req.Symbol,
+		TimeInForce:   req.TimeInForce,
+		PostOnly:      req.PostOnly,
+		ClientOrderID: req.ClientOrderID,
+		Token:         token,
+	}
+
+	if req.Type != OrderTypeMarket {
+		params.LimitPrice = req.LimitPrice
+	}
+
+	var result addOrderResult
+
+	err = t.call(ctx, methodAddOrder, params, &result)
+	if err != nil {
+		return "", errors.Wrapf(err, "%s %s %s", req.Side, req.Symbol, req.Type)
+	}
+
+	return result.OrderID, nil
+}
+
+// SubscribeInstruments subscribes to the pair metadata used to validate orders.
+func (t *Trader) SubscribeInstruments(ctx context.Context) error {
+	return t.client.SubscribeInstruments(ctx)
+}
+
+// AmendOrder changes the quantity or limit price of an open order.
+func (t *Trader) AmendOrder(ctx context.Context, req AmendRequest) error {
+	token, err := t.client.authToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	params := amendOrderParams{
+		OrderID:    req.OrderID,
+		OrderQty:   req.Qty,
+		LimitPrice: req.LimitPrice,
+		Token:      token,
+	}
+
+	err = t.call(ctx, methodAmendOrder, params, nil)
+	if err != nil {
+		return errors.Wrap(err, req.OrderID)
+	}
+
+	return nil
+}
+
+// CancelOrder cancels the given open orders.
+func (t *Trader) CancelOrder(ctx context.Context, orderIDs ...string) error {
+	token, err := t.client.authToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = t.call(ctx, methodCancelOrder, cancelOrderParams{OrderID: orderIDs, Token: token}, nil)
+	if err != nil {
+		return errors.Wrap(err, strings.Join(orderIDs, ","))
+	}
+
+	return nil
+}
+
+// CancelAll cancels all open orders and returns the number of orders cancelled.
+func (t *Trader) CancelAll(ctx context.Context) (int, error) {
+	token, err := t.client.authToken(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var result cancelAllResult
+
+	err = t.call(ctx, methodCancelAll, tokenParams{Token: token}, &result)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.Count, nil
+}
+
+// normalize rounds the order to the increments of its pair and checks it
+// against the pair minimums. Limits are rounded away from the book, a sell
+// down and a buy up, so that the order still takes every level it was priced
+// to take. Orders of unknown pairs are left as they are.
+func (t *Trader) normalize(req OrderRequest) (OrderRequest, error) {
+	pair, ok := t.client.instruments.Get(req.Symbol)
+	if !ok {
+		return req, nil
+	}
+
+	var price float64
+
+	req.Qty = pair.RoundQty(req.Qty)
+
+	if req.Type != OrderTypeMarket {
+		switch req.Side {
+		case SideSell:
+			req.LimitPrice = pair.FloorPrice(req.LimitPrice)
+		case SideBuy:
+			req.LimitPrice = pair.CeilPrice(req.LimitPrice)
+		default:
+			req.LimitPrice = pair.RoundPrice(req.LimitPrice)
+		}
+
+		price = req.LimitPrice
+	}
+
+	err := pair.Validate(req.Qty, price)
+	if errors.Is(err, instrument.ErrBelowMinimum) {
+		return req, errors.Wrap(ErrOrderMinimum, err.Error())
+	}
+
+	if err != nil {
+		return req, errors.Wrap(ErrInvalidArguments, err.Error())
+	}
+
+	return req, nil
+}
+
+// call sends a method request, maps a failure to a typed error and, if
+// result is not nil, unmarshals the result into it.
+func (t *Trader) call(ctx context.Context, method string, params any, result any) error {
+	ack, err := t.client.call(ctx, method, params)
+	if err != nil {
+		return err
+	}
+
+	if !ack.Success {
+		return errors.Wrapf(orderError(ack.Error), "%s: %s", method, ack.Error)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	err = json.Unmarshal(ack.Result, result)
+	if err != nil {
+		return errors.Wrapf(err, "error unmarshalling %s result", method)
+	}
+
+	return nil
+}
+
+// orderError maps a Kraken order error message to a typed error.
+func orderError(message string) error {
+	switch {
+	case strings.HasPrefix(message, "EOrder:Insufficient funds"):
+		return ErrInsufficientFunds
+	case strings.HasPrefix(message, "EOrder:Order minimum not met"),
+		strings.HasPrefix(message, "EOrder:Cost minimum not met"):
+		return ErrOrderMinimum
+	case strings.HasPrefix(message, "EOrder:Unknown order"):
+		return ErrUnknownOrder
+	}
+
+	err := apiError(message)
+	if errors.Is(err, ErrRequestFailed) {
+		return ErrOrderRejected
+	}
+
+	return err
+}
@@ -0,0 +1,105 @@
+package kraken
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/peetermeos/tabot/internal/app/tabot"
+	"github.com/pkg/errors"
+)
+
+func Test_orderError(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    error
+	}{
+		{"Insufficient funds", "EOrder:Insufficient funds", ErrInsufficientFunds},
+		{"Order minimum", "EOrder:Order minimum not met", ErrOrderMinimum},
+		{"Unknown order", "EOrder:Unknown order", ErrUnknownOrder},
+		{"Invalid arguments", "EGeneral:Invalid arguments:volume", ErrInvalidArguments},
+		{"Rate limited", "EOrder:Rate limit exceeded", ErrRateLimited},
+		{"Invalid nonce", "EAPI:Invalid nonce", ErrAuthFailed},
+		{"Cancel only", "EService:Market in cancel_only mode", ErrMarketUnavailable},
+		{"Other", "EOrder:Cannot open position", ErrOrderRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := orderError(tt.message); !errors.Is(got, tt.want) {
+				t.Errorf("orderError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_await(t *testing.T) {
+	tests := []struct {
+		name    string
+		fills   []Fill
+		status  string
+		want    tabot.ExecutionResult
+		wantErr error
+	}{
+		{
+			name: "Filled before placed",
+			fills: []Fill{
+				{OrderID: "O1", Qty: 1, Price: 100, Fee: 0.1, FeeAsset: "USD"},
+				{OrderID: "O2", Qty: 5, Price: 1},
+				{OrderID: "O1", Qty: 3, Price: 104, Fee: 0.3, FeeAsset: "USD"},
+			},
+			status: "filled",
+			want:   tabot.ExecutionResult{Qty: 4, Price: 103, Fee: 0.4, FeeAsset: "USD"},
+		},
+		{
+			name:    "Cancelled",
+			status:  "canceled",
+			wantErr: ErrOrderNotFilled,
+		},
+		{
+			name: "Timed out after a partial fill",
+			fills: []Fill{
+				{OrderID: "O1", Qty: 1, Price: 100, Fee: 0.1, FeeAsset: "USD"},
+			},
+			wantErr: context.DeadlineExceeded,
+			want:    tabot.ExecutionResult{Qty: 1, Price: 100, Fee: 0.1, FeeAsset: "USD"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fills := make(chan Fill, len(tt.fills))
+			orders := make(chan OrderStatus, 2)
+			placed := make(chan string, 1)
+
+			for _, fill := range tt.fills {
+				fills <- fill
+			}
+
+			orders <- OrderStatus{OrderID: "O2", Status: "filled"}
+			if tt.status != "" {
+				orders <- OrderStatus{OrderID: "O1", Status: tt.status}
+			}
+
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				placed <- "O1"
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			got, err := await(ctx, placed, fills, orders)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("await() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if math.Abs(got.Price-tt.want.Price) > 1e-9 || got.Qty != tt.want.Qty ||
+				math.Abs(got.Fee-tt.want.Fee) > 1e-9 || got.FeeAsset != tt.want.FeeAsset {
+				t.Errorf("await() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/peetermeos/tabot/internal/app/tabot"
+	"github.com/peetermeos/tabot/internal/pkg/fees"
+	"github.com/peetermeos/tabot/internal/pkg/kraken"
+	"github.com/peetermeos/tabot/internal/pkg/orderbook"
+	"github.com/pkg/errors"
+)
+
+// paperPollInterval is how often resting orders are matched against the
+// books.
+const paperPollInterval = 100 * time.Millisecond
+
+// BookSource provides the live L2 order books paper orders fill against.
+type BookSource interface {
+	OrderBook(symbol string) (*orderbook.Book, bool)
+}
+
+// levelKey identifies a price level of a book.
+type levelKey struct {
+	symbol string
+	side   orderbook.Side
+	price  float64
+}
+
+// consumption is the volume paper orders took from a level, as long as the
+// level still has the volume it had then.
+type consumption struct {
+	volume float64
+	taken  float64
+}
+
+// taking is the volume an order took from a level.
+type taking struct {
+	key    levelKey
+	volume float64
+	amount float64
+}
+
+// PaperTrader fills orders against the live order books and books them in a
+// portfolio. Orders take the levels they cross, paying the taker fee, and the
+// volume they take stays unavailable to later orders until the exchange
+// updates the level. Limit orders that are not immediate or cancel rest at
+// their price until the market crosses them, paying the maker fee. Fees are
+// charged in the base, as on Kraken.
+type PaperTrader struct {
+	portfolio *Portfolio
+	books     BookSource
+	fees      *fees.Model
+	latency   time.Duration
+	poll      time.Duration
+
+	mu       sync.Mutex
+	consumed map[levelKey]consumption
+}
+
+// NewPaperTrader creates a paper trader booking its fills in the portfolio.
+// Orders see the books as they are after the given latency, so the books
+// must keep updating while orders are on their way.
+func NewPaperTrader(portfolio *Portfolio, books BookSource, feeModel *fees.Model, latency time.Duration) *PaperTrader {
+	return &PaperTrader{
+		portfolio: portfolio,
+		books:     books,
+		fees:      feeModel,
+		latency:   latency,
+		poll:      paperPollInterval,
+		consumed:  make(map[levelKey]consumption),
+	}
+}
+
+// Execute fills the order against the book of its pair. It returns once the
+// order no longer fills: right away for market and immediate or cancel
+// orders, otherwise when the order filled in full or ctx is done. Orders are
+// validated like the portfolio's, and a fill the portfolio cannot pay for is
+// rejected, leaving the volume it took to later orders.
+func (p *PaperTrader) Execute(ctx context.Context, input tabot.ExecutionInput) (tabot.ExecutionResult, error) {
+	pair := fmt.Sprintf("%s/%s", input.Symbol, input.Base)
+
+	err := validate(input)
+	if err != nil {
+		return tabot.ExecutionResult{}, err
+	}
+
+	err = sleep(ctx, p.latency)
+	if err != nil {
+		return tabot.ExecutionResult{}, err
+	}
+
+	qty, cost, takings, err := p.take(pair, input.Side, input.Qty, input.Rate)
+	if err != nil {
+		return tabot.ExecutionResult{}, err
+	}
+
+	fee := cost * p.fees.Taker(pair)
+
+	// The rest of a limit order rests at its price, filling as a maker once
+	// the market trades through it
+	if qty < input.Qty && input.Rate > 0 && !input.ImmediateOrCancel {
+		ticker := time.NewTicker(p.poll)
+		defer ticker.Stop()
+
+		for qty < input.Qty && ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case <-ticker.C:
+				filled, _, taken, err := p.take(pair, input.Side, input.Qty-qty, input.Rate)
+				if err != nil {
+					continue
+				}
+
+				takings = append(takings, taken...)
+				qty += filled
+				cost += filled * input.Rate
+				fee += filled * input.Rate * p.fees.Maker(pair)
+			}
+		}
+	}
+
+	if qty <= 0 {
+		if ctx.Err() != nil {
+			return tabot.ExecutionResult{}, ctx.Err()
+		}
+
+		return tabot.ExecutionResult{}, errors.Wrapf(kraken.ErrOrderNotFilled, "%s %s", input.Side, pair)
+	}
+
+	result := tabot.ExecutionResult{
+		Qty:      qty,
+		Price:    cost / qty,
+		Fee:      fee,
+		FeeAsset: input.Base,
+	}
+
+	err = p.portfolio.settle(input, result)
+	if err != nil {
+		p.release(takings)
+
+		return tabot.ExecutionResult{}, err
+	}
+
+	return result, nil
+}
+
+// TotalCapital returns the balance of the portfolio's base asset.
+func (p *PaperTrader) TotalCapital() float64 {
+	return p.portfolio.TotalCapital()
+}
+
+// take fills up to qty from the levels of the book the order crosses, the
+// asks for a buy and the bids for a sell, and returns the quantity filled,
+// its cost and the volume taken from each level. A zero limit crosses every
+// level.
+func (p *PaperTrader) take(pair, side string, qty, limit float64) (float64, float64, []taking, error) {
+	book, ok := p.books.OrderBook(pair)
+	if !ok {
+		return 0, 0, nil, errors.Wrapf(kraken.ErrMarketUnavailable, "no book for %s", pair)
+	}
+
+	bookSide := orderbook.Ask
+
+	crosses := func(price float64) bool { return limit <= 0 || price <= limit }
+
+	switch side {
+	case kraken.SideBuy:
+	case kraken.SideSell:
+		bookSide = orderbook.Bid
+		crosses = func(price float64) bool { return limit <= 0 || price >= limit }
+	default:
+		return 0, 0, nil, errors.Wrap(kraken.ErrInvalidArguments, side)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var (
+		filled, cost float64
+		takings      []taking
+	)
+
+	for _, level := range book.Levels(bookSide, 0) {
+		if filled >= qty || !crosses(level.Price) {
+			break
+		}
+
+		key := levelKey{symbol: pair, side: bookSide, price: level.Price}
+
+		// Once the exchange updates the level, what was taken before is
+		// accounted for
+		used := p.consumed[key]
+		if used.volume != level.Volume {
+			used = consumption{volume: level.Volume}
+		}
+
+		take := math.Min(qty-filled, level.Volume-used.taken)
+		if take <= 0 {
+			continue
+		}
+
+		used.taken += take
+		p.consumed[key] = used
+		takings = append(takings, taking{key: key, volume: level.Volume, amount: take})
+
+		filled += take
+		cost += take * level.Price
+	}
+
+	return filled, cost, takings, nil
+}
+
+// release returns the volume taken by a rejected order to the levels it was
+// taken from, unless the exchange has updated them since.
+func (p *PaperTrader) release(takings []taking) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, t := range takings {
+		used, ok := p.consumed[t.key]
+		if !ok || used.volume != t.volume {
+			continue
+		}
+
+		used.taken = math.Max(used.taken-t.amount, 0)
+		p.consumed[t.key] = used
+	}
+}
+
+// sleep waits for the duration or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,203 @@
+package mock
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/peetermeos/tabot/internal/app/tabot"
+	"github.com/peetermeos/tabot/internal/pkg/fees"
+	"github.com/peetermeos/tabot/internal/pkg/kraken"
+	"github.com/peetermeos/tabot/internal/pkg/orderbook"
+	"github.com/pkg/errors"
+)
+
+// books is a book source whose books can change while orders rest.
+type books struct {
+	mu    sync.Mutex
+	books map[string]*orderbook.Book
+}
+
+func (b *books) OrderBook(symbol string) (*orderbook.Book, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	book, ok := b.books[symbol]
+	if !ok {
+		return nil, false
+	}
+
+	return book.Clone(), true
+}
+
+func (b *books) set(symbol string, s orderbook.Side, price, volume float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.books[symbol].Set(s, price, volume)
+}
+
+func newPaperTrader() (*PaperTrader, *books) {
+	book := orderbook.New("BTC/USD", 10)
+	book.ApplySnapshot(
+		[]orderbook.Level{{Price: 99, Volume: 1}, {Price: 98, Volume: 1}},
+		[]orderbook.Level{{Price: 100, Volume: 1}, {Price: 101, Volume: 2}},
+	)
+
+	source := &books{books: map[string]*orderbook.Book{"BTC/USD": book}}
+	feeModel := fees.NewModel([]fees.Tier{{Rates: fees.Rates{Maker: 0.001, Taker: 0.002}}}, 0)
+
+	portfolio := NewPortfolio(10000, "USD", feeModel, source)
+	portfolio.capital["BTC"] = 3
+
+	p := NewPaperTrader(portfolio, source, feeModel, 0)
+	p.poll = time.Millisecond
+
+	return p, source
+}
+
+func TestPaperTrader_Execute(t *testing.T) {
+	tests := []struct {
+		name    string
+		inputs  []tabot.ExecutionInput
+		want    tabot.ExecutionResult
+		wantErr error
+	}{
+		{
+			name:   "Market buy walks the book",
+			inputs: []tabot.ExecutionInput{{Symbol: "BTC", Base: "USD", Side: "buy", Qty: 2}},
+			want:   tabot.ExecutionResult{Qty: 2, Price: 100.5, Fee: 201 * 0.002, FeeAsset: "USD"},
+		},
+		{
+			name: "Taken volume stays taken",
+			inputs: []tabot.ExecutionInput{
+				{Symbol: "BTC", Base: "USD", Side: "buy", Qty: 2},
+				{Symbol: "BTC", Base: "USD", Side: "buy", Qty: 2},
+			},
+			want: tabot.ExecutionResult{Qty: 1, Price: 101, Fee: 101 * 0.002, FeeAsset: "USD"},
+		},
+		{
+			name:   "Immediate or cancel limit sell",
+			inputs: []tabot.ExecutionInput{{Symbol: "BTC", Base: "USD", Side: "sell", Qty: 3, Rate: 98, ImmediateOrCancel: true}},
+			want:   tabot.ExecutionResult{Qty: 2, Price: 98.5, Fee: 197 * 0.002, FeeAsset: "USD"},
+		},
+		{
+			name:    "Limit not crossed",
+			inputs:  []tabot.ExecutionInput{{Symbol: "BTC", Base: "USD", Side: "buy", Qty: 1, Rate: 99, ImmediateOrCancel: true}},
+			wantErr: kraken.ErrOrderNotFilled,
+		},
+		{
+			name:    "No book",
+			inputs:  []tabot.ExecutionInput{{Symbol: "ETH", Base: "USD", Side: "buy", Qty: 1}},
+			wantErr: kraken.ErrMarketUnavailable,
+		},
+		{
+			name:    "Unknown side",
+			inputs:  []tabot.ExecutionInput{{Symbol: "BTC", Base: "USD", Side: "hold", Qty: 1}},
+			wantErr: kraken.ErrInvalidArguments,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newPaperTrader()
+
+			var (
+				got tabot.ExecutionResult
+				err error
+			)
+
+			for _, input := range tt.inputs {
+				got, err = p.Execute(context.Background(), input)
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Execute() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got.Qty != tt.want.Qty || math.Abs(got.Price-tt.want.Price) > 1e-9 ||
+				math.Abs(got.Fee-tt.want.Fee) > 1e-9 || got.FeeAsset != tt.want.FeeAsset {
+				t.Errorf("Execute() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaperTrader_Execute_insufficientFunds(t *testing.T) {
+	p, _ := newPaperTrader()
+	p.portfolio.capital["BTC"] = 0.5
+
+	input := tabot.ExecutionInput{Symbol: "BTC", Base: "USD", Side: "sell", Qty: 1, Rate: 98, ImmediateOrCancel: true}
+
+	_, err := p.Execute(context.Background(), input)
+	if !errors.Is(err, kraken.ErrInsufficientFunds) {
+		t.Fatalf("Execute() error = %v, want %v", err, kraken.ErrInsufficientFunds)
+	}
+
+	// The rejected order left the best bid to the next one
+	p.portfolio.capital["BTC"] = 3
+
+	got, err := p.Execute(context.Background(), input)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if got.Qty != 1 || got.Price != 99 {
+		t.Errorf("Execute() = %+v, want 1 at 99", got)
+	}
+}
+
+func TestPaperTrader_Execute_latency(t *testing.T) {
+	p, source := newPaperTrader()
+	p.latency = 50 * time.Millisecond
+
+	// The best ask is gone by the time the order reaches the exchange
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		source.set("BTC/USD", orderbook.Ask, 100, 0)
+	}()
+
+	got, err := p.Execute(context.Background(), tabot.ExecutionInput{Symbol: "BTC", Base: "USD", Side: "buy", Qty: 1})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if got.Qty != 1 || got.Price != 101 {
+		t.Errorf("Execute() = %+v, want 1 at 101", got)
+	}
+}
+
+func TestPaperTrader_Execute_resting(t *testing.T) {
+	p, source := newPaperTrader()
+
+	// The bids move up through the resting sell after a while
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		source.set("BTC/USD", orderbook.Bid, 106, 5)
+	}()
+
+	got, err := p.Execute(context.Background(), tabot.ExecutionInput{Symbol: "BTC", Base: "USD", Side: "sell", Qty: 1, Rate: 105})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	// Filled at the limit as a maker
+	if got.Qty != 1 || got.Price != 105 || math.Abs(got.Fee-0.105) > 1e-9 {
+		t.Errorf("Execute() = %+v", got)
+	}
+
+	if balance := p.TotalCapital(); math.Abs(balance-(10000+105-0.105)) > 1e-9 {
+		t.Errorf("TotalCapital() = %v, want %v", balance, 10000+105-0.105)
+	}
+
+	// A resting order that never fills ends with its context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = p.Execute(ctx, tabot.ExecutionInput{Symbol: "BTC", Base: "USD", Side: "buy", Qty: 1, Rate: 90})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Execute() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -2,49 +2,180 @@ package mock
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
 
 	"github.com/peetermeos/tabot/internal/app/tabot"
+	"github.com/peetermeos/tabot/internal/pkg/fees"
+	"github.com/peetermeos/tabot/internal/pkg/kraken"
+	"github.com/pkg/errors"
 )
 
+// fundsTolerance is the relative shortfall still accepted as enough funds, so
+// that selling what an earlier fill bought is not rejected for float noise.
+const fundsTolerance = 1e-9
+
+// Portfolio holds simulated balances starting from capital in the base. It
+// keeps the cost basis of every other asset in the base, so that holdings can
+// be marked to market against the live books.
 type Portfolio struct {
-	capital map[string]float64
-	fee     float64
-	base    string
+	mu       sync.Mutex
+	capital  map[string]float64
+	basis    map[string]float64
+	realized float64
+	equity   []EquityPoint
+	fees     *fees.Model
+	books    BookSource
+	base     string
 }
 
-func NewPortfolio(capital float64, base string, fee float64) *Portfolio {
+// NewPortfolio creates a portfolio holding the capital in the base. Holdings
+// are valued at the mid prices of the books, which may be nil to value only
+// the base.
+func NewPortfolio(capital float64, base string, feeModel *fees.Model, books BookSource) *Portfolio {
 	p := Portfolio{
 		capital: map[string]float64{base: capital},
-		fee:     fee,
+		basis:   make(map[string]float64),
+		fees:    feeModel,
+		books:   books,
 		base:    base,
 	}
 
 	return &p
 }
 
-func (p *Portfolio) Execute(_ context.Context, input tabot.ExecutionInput) error {
-	_, exists := p.capital[input.Base]
-	if !exists {
-		p.capital[input.Base] = 0
+// Execute fills the order in full at its rate, charging the taker fee in the
+// currency bought. Orders without a rate, with a bad side or quantity, or
+// spending more than the portfolio holds are rejected with the errors the
+// exchange returns for them.
+func (p *Portfolio) Execute(_ context.Context, input tabot.ExecutionInput) (tabot.ExecutionResult, error) {
+	err := validate(input)
+	if err != nil {
+		return tabot.ExecutionResult{}, err
+	}
+
+	// Fills happen at the rate of the order, there is no book to price it
+	if !(input.Rate > 0) || math.IsInf(input.Rate, 0) {
+		return tabot.ExecutionResult{}, errors.Wrapf(kraken.ErrInvalidArguments, "rate %v", input.Rate)
+	}
+
+	// Simulated fills always take liquidity
+	fee := p.fees.Taker(fmt.Sprintf("%s/%s", input.Symbol, input.Base))
+
+	result := tabot.ExecutionResult{
+		Qty:   input.Qty,
+		Price: input.Rate,
+	}
+
+	if input.Side == kraken.SideBuy {
+		result.Fee, result.FeeAsset = input.Qty*fee, input.Symbol
+	} else {
+		result.Fee, result.FeeAsset = input.Rate*input.Qty*fee, input.Base
+	}
+
+	err = p.settle(input, result)
+	if err != nil {
+		return tabot.ExecutionResult{}, err
+	}
+
+	return result, nil
+}
+
+// validate rejects orders with an unknown side or a quantity that is not
+// positive.
+func validate(input tabot.ExecutionInput) error {
+	if input.Side != kraken.SideBuy && input.Side != kraken.SideSell {
+		return errors.Wrapf(kraken.ErrInvalidArguments, "side %q", input.Side)
+	}
+
+	if !(input.Qty > 0) || math.IsInf(input.Qty, 0) {
+		return errors.Wrapf(kraken.ErrInvalidArguments, "quantity %v", input.Qty)
+	}
+
+	return nil
+}
+
+// settle books the fill of the order and marks the portfolio to market.
+func (p *Portfolio) settle(input tabot.ExecutionInput, result tabot.ExecutionResult) error {
+	err := p.book(input, result)
+	if err != nil {
+		return err
+	}
+
+	p.Mark(time.Now())
+
+	return nil
+}
+
+// book books the fill of the order, charging its fee in the fee asset or the
+// base if it has none. A fill spending more of an asset than the portfolio
+// holds is not booked. What the fill spends takes its cost basis along to the
+// asset bought, or realizes it against the base the fill returns.
+func (p *Portfolio) book(input tabot.ExecutionInput, result tabot.ExecutionResult) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	feeAsset := result.FeeAsset
+	if feeAsset == "" {
+		feeAsset = input.Base
+	}
+
+	changes := map[string]float64{
+		input.Symbol: result.Qty,
+		input.Base:   -result.Price * result.Qty,
 	}
 
-	_, exists = p.capital[input.Symbol]
-	if !exists {
-		p.capital[input.Symbol] = 0
+	if input.Side == kraken.SideSell {
+		changes[input.Symbol], changes[input.Base] = -changes[input.Symbol], -changes[input.Base]
 	}
 
-	if input.Side == "buy" {
-		p.capital[input.Base] -= input.Rate * input.Qty
-		p.capital[input.Symbol] += input.Qty * (1 - p.fee)
-	} else if input.Side == "sell" {
-		p.capital[input.Base] += input.Rate * input.Qty * (1 - p.fee)
-		p.capital[input.Symbol] -= input.Qty
+	changes[feeAsset] -= result.Fee
+
+	for asset, change := range changes {
+		if change < 0 && p.capital[asset]+change < change*fundsTolerance {
+			return errors.Wrapf(kraken.ErrInsufficientFunds, "%s %s needs %v %s, have %v",
+				input.Side, input.Symbol, -change, asset, p.capital[asset])
+		}
+	}
+
+	var spent float64
+
+	bought := ""
+
+	for asset, change := range changes {
+		switch {
+		case change > 0 && asset != p.base:
+			bought = asset
+		case change < 0 && asset == p.base:
+			spent -= change
+		case change < 0 && p.capital[asset] > 0:
+			share := p.basis[asset] * math.Min(1, -change/p.capital[asset])
+			p.basis[asset] -= share
+			spent += share
+		}
+	}
+
+	if bought != "" {
+		p.basis[bought] += spent
+	} else {
+		p.realized += math.Max(changes[p.base], 0) - spent
+	}
+
+	for asset, change := range changes {
+		p.capital[asset] += change
 	}
 
 	return nil
 }
 
+// TotalCapital returns the balance of the base available to trade, like the
+// live trader does. Value and Equity report what the portfolio is worth.
 func (p *Portfolio) TotalCapital() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	currentBase, exists := p.capital[p.base]
 	if exists {
 		return currentBase
@@ -0,0 +1,103 @@
+package mock
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/peetermeos/tabot/internal/app/tabot"
+	"github.com/peetermeos/tabot/internal/pkg/fees"
+	"github.com/peetermeos/tabot/internal/pkg/kraken"
+	"github.com/pkg/errors"
+)
+
+func TestPortfolio_Execute(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   tabot.ExecutionInput
+		want    map[string]float64
+		wantErr error
+	}{
+		{
+			name:  "Buy",
+			input: tabot.ExecutionInput{Symbol: "BTC", Base: "USD", Side: "buy", Qty: 10, Rate: 100},
+			want:  map[string]float64{"USD": 0, "BTC": 10 - 0.01},
+		},
+		{
+			name:    "Buy more than the base pays for",
+			input:   tabot.ExecutionInput{Symbol: "BTC", Base: "USD", Side: "buy", Qty: 10.01, Rate: 100},
+			want:    map[string]float64{"USD": 1000},
+			wantErr: kraken.ErrInsufficientFunds,
+		},
+		{
+			name:    "Sell what is not held",
+			input:   tabot.ExecutionInput{Symbol: "BTC", Base: "USD", Side: "sell", Qty: 1, Rate: 100},
+			want:    map[string]float64{"USD": 1000},
+			wantErr: kraken.ErrInsufficientFunds,
+		},
+		{
+			name:    "Unknown side",
+			input:   tabot.ExecutionInput{Symbol: "BTC", Base: "USD", Side: "short", Qty: 1, Rate: 100},
+			want:    map[string]float64{"USD": 1000},
+			wantErr: kraken.ErrInvalidArguments,
+		},
+		{
+			name:    "Zero quantity",
+			input:   tabot.ExecutionInput{Symbol: "BTC", Base: "USD", Side: "buy", Rate: 100},
+			want:    map[string]float64{"USD": 1000},
+			wantErr: kraken.ErrInvalidArguments,
+		},
+		{
+			name:    "Negative quantity",
+			input:   tabot.ExecutionInput{Symbol: "BTC", Base: "USD", Side: "sell", Qty: -1, Rate: 100},
+			want:    map[string]float64{"USD": 1000},
+			wantErr: kraken.ErrInvalidArguments,
+		},
+		{
+			name:    "No rate",
+			input:   tabot.ExecutionInput{Symbol: "BTC", Base: "USD", Side: "buy", Qty: 1},
+			want:    map[string]float64{"USD": 1000},
+			wantErr: kraken.ErrInvalidArguments,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feeModel := fees.NewModel([]fees.Tier{{Rates: fees.Rates{Maker: 0.0005, Taker: 0.001}}}, 0)
+			p := NewPortfolio(1000, "USD", feeModel, nil)
+
+			_, err := p.Execute(context.Background(), tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Execute() error = %v, want %v", err, tt.wantErr)
+			}
+
+			for asset, want := range tt.want {
+				if got := p.capital[asset]; math.Abs(got-want) > 1e-9 {
+					t.Errorf("capital[%s] = %v, want %v", asset, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPortfolio_Execute_roundTrip(t *testing.T) {
+	feeModel := fees.NewModel([]fees.Tier{{Rates: fees.Rates{Taker: 0.001}}}, 0)
+	p := NewPortfolio(1000, "USD", feeModel, nil)
+
+	bought, err := p.Execute(context.Background(), tabot.ExecutionInput{Symbol: "ETH", Base: "USD", Side: "buy", Qty: 0.3, Rate: 3000})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	// Selling exactly what the buy left after its fee is not short of funds
+	_, err = p.Execute(context.Background(), tabot.ExecutionInput{
+		Symbol: "ETH", Base: "USD", Side: "sell", Qty: bought.Qty - bought.Fee, Rate: 3000,
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if got := p.capital["ETH"]; math.Abs(got) > 1e-12 {
+		t.Errorf("capital[ETH] = %v, want 0", got)
+	}
+}
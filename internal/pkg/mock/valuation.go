@@ -0,0 +1,201 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// equityPoints is how many marks of the equity the portfolio keeps, a week of
+// marks a minute apart.
+const equityPoints = 7 * 24 * 60
+
+var ErrNoRate = errors.New("no rate")
+
+// EquityPoint is the value of the portfolio in its base at a time.
+type EquityPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// PnL is the profit of the portfolio in its base. Realized profit is what
+// fills returned to the base over the cost basis they spent, unrealized profit
+// is the market value of the other assets held over their cost basis.
+type PnL struct {
+	Realized   float64
+	Unrealized float64
+}
+
+// Balances returns the balance of every asset the portfolio has held.
+func (p *Portfolio) Balances() map[string]float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	balances := make(map[string]float64, len(p.capital))
+	for asset, balance := range p.capital {
+		balances[asset] = balance
+	}
+
+	return balances
+}
+
+// Value returns the value of the portfolio in the currency. Each holding is
+// valued in the base at the mid price of its pair and the total converted to
+// the currency. Holdings without a rate fail with ErrNoRate, with the value of
+// the others still returned.
+func (p *Portfolio) Value(currency string) (float64, error) {
+	var (
+		total float64
+		err   error
+	)
+
+	for asset, balance := range p.Balances() {
+		if balance == 0 {
+			continue
+		}
+
+		value, ok := p.convert(balance, asset, p.base)
+		if !ok {
+			err = errors.Wrapf(ErrNoRate, "%s/%s", asset, p.base)
+
+			continue
+		}
+
+		total += value
+	}
+
+	converted, ok := p.convert(total, p.base, currency)
+	if !ok {
+		return 0, errors.Wrapf(ErrNoRate, "%s/%s", p.base, currency)
+	}
+
+	return converted, err
+}
+
+// PnL returns the realized and unrealized profit of the portfolio. Holdings
+// without a rate to the base fail with ErrNoRate and count as unrealized
+// losses of their cost basis.
+func (p *Portfolio) PnL() (PnL, error) {
+	p.mu.Lock()
+	pnl := PnL{Realized: p.realized}
+
+	balances, basis := make(map[string]float64, len(p.capital)), make(map[string]float64, len(p.basis))
+	for asset, balance := range p.capital {
+		balances[asset], basis[asset] = balance, p.basis[asset]
+	}
+
+	p.mu.Unlock()
+
+	var err error
+
+	for asset, balance := range balances {
+		if asset == p.base {
+			continue
+		}
+
+		value, ok := p.convert(balance, asset, p.base)
+		if !ok && balance != 0 {
+			err = errors.Wrapf(ErrNoRate, "%s/%s", asset, p.base)
+		}
+
+		pnl.Unrealized += value - basis[asset]
+	}
+
+	return pnl, err
+}
+
+// Mark records the value of the portfolio in its base at the time and
+// returns it. Assets the books cannot price count as nothing.
+func (p *Portfolio) Mark(now time.Time) EquityPoint {
+	value, _ := p.Value(p.base)
+	point := EquityPoint{Time: now, Value: value}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.equity = append(p.equity, point)
+	if len(p.equity) > equityPoints {
+		p.equity = p.equity[len(p.equity)-equityPoints:]
+	}
+
+	return point
+}
+
+// Equity returns the recorded values of the portfolio, oldest first. The
+// portfolio is marked after every fill and on every Mark.
+func (p *Portfolio) Equity() []EquityPoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]EquityPoint(nil), p.equity...)
+}
+
+// Track marks the portfolio at the interval until ctx is done.
+func (p *Portfolio) Track(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.Mark(now)
+		}
+	}
+}
+
+// convert converts the amount at the mid price of the pair of the currencies,
+// or through another currency the portfolio has held if they do not trade
+// against each other.
+func (p *Portfolio) convert(amount float64, from, to string) (float64, bool) {
+	rate, ok := p.rate(from, to)
+	if ok {
+		return amount * rate, true
+	}
+
+	for via := range p.Balances() {
+		if via == from || via == to {
+			continue
+		}
+
+		first, ok := p.rate(from, via)
+		if !ok {
+			continue
+		}
+
+		second, ok := p.rate(via, to)
+		if ok {
+			return amount * first * second, true
+		}
+	}
+
+	return 0, false
+}
+
+// rate returns the mid price of the pair of the currencies, inverted if only
+// the opposite pair has a book.
+func (p *Portfolio) rate(from, to string) (float64, bool) {
+	if from == to {
+		return 1, true
+	}
+
+	if p.books == nil {
+		return 0, false
+	}
+
+	if book, ok := p.books.OrderBook(from + "/" + to); ok {
+		if mid, ok := book.Mid(); ok && mid > 0 {
+			return mid, true
+		}
+	}
+
+	if book, ok := p.books.OrderBook(to + "/" + from); ok {
+		if mid, ok := book.Mid(); ok && mid > 0 {
+			return 1 / mid, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,155 @@
+package mock
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/peetermeos/tabot/internal/app/tabot"
+	"github.com/peetermeos/tabot/internal/pkg/fees"
+	"github.com/peetermeos/tabot/internal/pkg/orderbook"
+	"github.com/pkg/errors"
+)
+
+// newBook creates a book with a single level on each side.
+func newBook(symbol string, bid, ask float64) *orderbook.Book {
+	book := orderbook.New(symbol, 10)
+	book.ApplySnapshot([]orderbook.Level{{Price: bid, Volume: 1}}, []orderbook.Level{{Price: ask, Volume: 1}})
+
+	return book
+}
+
+func newValuedPortfolio() (*Portfolio, *books) {
+	source := &books{books: map[string]*orderbook.Book{
+		"BTC/USD": newBook("BTC/USD", 99, 101),
+		"ETH/BTC": newBook("ETH/BTC", 0.049, 0.051),
+		"USD/JPY": newBook("USD/JPY", 149, 151),
+	}}
+
+	p := NewPortfolio(1000, "USD", fees.NewModel([]fees.Tier{{}}, 0), source)
+	p.capital["BTC"] = 2
+	p.capital["ETH"] = 10
+	p.capital["SOL"] = 0
+
+	return p, source
+}
+
+func TestPortfolio_Value(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		extra    map[string]float64
+		want     float64
+		wantErr  error
+	}{
+		{
+			name:     "Base",
+			currency: "USD",
+			want:     1000 + 2*100 + 10*0.05*100,
+		},
+		{
+			name:     "Direct and inverse pairs",
+			currency: "BTC",
+			want:     1000.0/100 + 2 + 10*0.05,
+		},
+		{
+			name:     "Through the base",
+			currency: "JPY",
+			want:     (1000 + 2*100 + 10*0.05*100) * 150,
+		},
+		{
+			name:     "Holding without a rate",
+			currency: "USD",
+			extra:    map[string]float64{"DOGE": 100},
+			want:     1000 + 2*100 + 10*0.05*100,
+			wantErr:  ErrNoRate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newValuedPortfolio()
+			for asset, balance := range tt.extra {
+				p.capital[asset] = balance
+			}
+
+			got, err := p.Value(tt.currency)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Value() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("Value() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortfolio_PnL(t *testing.T) {
+	source := &books{books: map[string]*orderbook.Book{"BTC/USD": newBook("BTC/USD", 99, 101)}}
+	p := NewPortfolio(1000, "USD", fees.NewModel([]fees.Tier{{}}, 0), source)
+
+	execute := func(side string, qty, rate float64) {
+		t.Helper()
+
+		_, err := p.Execute(context.Background(), tabot.ExecutionInput{Symbol: "BTC", Base: "USD", Side: side, Qty: qty, Rate: rate})
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+	}
+
+	check := func(want PnL) {
+		t.Helper()
+
+		got, err := p.PnL()
+		if err != nil {
+			t.Fatalf("PnL() error = %v", err)
+		}
+
+		if math.Abs(got.Realized-want.Realized) > 1e-9 || math.Abs(got.Unrealized-want.Unrealized) > 1e-9 {
+			t.Errorf("PnL() = %+v, want %+v", got, want)
+		}
+	}
+
+	execute("buy", 4, 90)
+	check(PnL{Unrealized: 4 * (100 - 90)})
+
+	// Half the holding is sold above its cost, the rest marked at the new mid
+	execute("sell", 2, 110)
+	source.books["BTC/USD"] = newBook("BTC/USD", 119, 121)
+	check(PnL{Realized: 2 * (110 - 90), Unrealized: 2 * (120 - 90)})
+
+	// Only the base is available to trade, the BTC still counts as equity
+	if got := p.TotalCapital(); math.Abs(got-(1000-360+220)) > 1e-9 {
+		t.Errorf("TotalCapital() = %v, want %v", got, 1000-360+220)
+	}
+
+	if got, err := p.Value("USD"); err != nil || math.Abs(got-(1000-360+220+240)) > 1e-9 {
+		t.Errorf("Value() = %v, %v, want %v", got, err, 1000-360+220+240)
+	}
+}
+
+func TestPortfolio_Equity(t *testing.T) {
+	p, source := newValuedPortfolio()
+
+	_, err := p.Execute(context.Background(), tabot.ExecutionInput{Symbol: "BTC", Base: "USD", Side: "sell", Qty: 2, Rate: 100})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	source.books["ETH/BTC"] = newBook("ETH/BTC", 0.059, 0.061)
+
+	now := time.Now()
+	p.Mark(now)
+
+	got := p.Equity()
+	if len(got) != 2 {
+		t.Fatalf("Equity() has %d points, want 2", len(got))
+	}
+
+	// Marked after the fill and again once ETH rose
+	if math.Abs(got[0].Value-1250) > 1e-6 || math.Abs(got[1].Value-1260) > 1e-6 || !got[1].Time.Equal(now) {
+		t.Errorf("Equity() = %+v", got)
+	}
+}
@@ -0,0 +1,282 @@
+package orderbook
+
+import (
+	"sort"
+)
+
+// Side is a side of the order book.
+type Side int
+
+const (
+	Bid Side = iota
+	Ask
+)
+
+// Level is a single price level of the book.
+type Level struct {
+	Price  float64
+	Volume float64
+}
+
+// side holds the levels of one side of the book, indexed by price and ordered
+// from the best price to the worst.
+type side struct {
+	volumes map[float64]float64
+	prices  []float64
+	better  func(p1, p2 float64) bool
+}
+
+func newSide(better func(p1, p2 float64) bool) *side {
+	return &side{
+		volumes: make(map[float64]float64),
+		better:  better,
+	}
+}
+
+// set sets the volume at price, removing the level if volume is zero.
+func (s *side) set(price, volume float64) {
+	_, exists := s.volumes[price]
+
+	switch {
+	case volume == 0 && !exists:
+		return
+	case volume == 0:
+		delete(s.volumes, price)
+
+		idx := s.search(price)
+		s.prices = append(s.prices[:idx], s.prices[idx+1:]...)
+
+		return
+	case exists:
+		s.volumes[price] = volume
+
+		return
+	}
+
+	s.volumes[price] = volume
+
+	idx := s.search(price)
+	s.prices = append(s.prices, 0)
+	copy(s.prices[idx+1:], s.prices[idx:])
+	s.prices[idx] = price
+}
+
+// search returns the index of price, or where it would be inserted.
+func (s *side) search(price float64) int {
+	return sort.Search(len(s.prices), func(i int) bool { return !s.better(s.prices[i], price) })
+}
+
+// truncate drops all levels beyond depth.
+func (s *side) truncate(depth int) {
+	if depth <= 0 || len(s.prices) <= depth {
+		return
+	}
+
+	for _, price := range s.prices[depth:] {
+		delete(s.volumes, price)
+	}
+
+	s.prices = s.prices[:depth]
+}
+
+func (s *side) clear() {
+	s.volumes = make(map[float64]float64)
+	s.prices = s.prices[:0]
+}
+
+func (s *side) levels(n int) []Level {
+	if n <= 0 || n > len(s.prices) {
+		n = len(s.prices)
+	}
+
+	levels := make([]Level, n)
+
+	for i, price := range s.prices[:n] {
+		levels[i] = Level{Price: price, Volume: s.volumes[price]}
+	}
+
+	return levels
+}
+
+// Book is an order book of a single symbol. Both sides are ordered from the
+// best price to the worst: bids descending, asks ascending.
+type Book struct {
+	Symbol string
+
+	depth int
+	bids  *side
+	asks  *side
+}
+
+// New creates an empty book keeping at most depth levels per side.
+// Zero or negative depth keeps all levels.
+func New(symbol string, depth int) *Book {
+	return &Book{
+		Symbol: symbol,
+		depth:  depth,
+		bids:   newSide(func(p1, p2 float64) bool { return p1 > p2 }),
+		asks:   newSide(func(p1, p2 float64) bool { return p1 < p2 }),
+	}
+}
+
+// ApplySnapshot replaces the content of the book with the given levels.
+func (b *Book) ApplySnapshot(bids, asks []Level) {
+	b.bids.clear()
+	b.asks.clear()
+
+	b.ApplyUpdate(bids, asks)
+}
+
+// ApplyUpdate patches the book with the given levels. A level with zero volume
+// removes the price level. Levels beyond the book depth are dropped.
+func (b *Book) ApplyUpdate(bids, asks []Level) {
+	for _, level := range bids {
+		b.bids.set(level.Price, level.Volume)
+	}
+
+	for _, level := range asks {
+		b.asks.set(level.Price, level.Volume)
+	}
+
+	b.bids.truncate(b.depth)
+	b.asks.truncate(b.depth)
+}
+
+// Set sets the volume of a single price level, zero volume removes it.
+func (b *Book) Set(s Side, price, volume float64) {
+	b.side(s).set(price, volume)
+	b.side(s).truncate(b.depth)
+}
+
+// Levels returns the top n levels of the side, best first.
+// Zero or negative n returns all levels.
+func (b *Book) Levels(s Side, n int) []Level {
+	return b.side(s).levels(n)
+}
+
+// Bids returns all bid levels, highest price first.
+func (b *Book) Bids() []Level {
+	return b.bids.levels(0)
+}
+
+// Asks returns all ask levels, lowest price first.
+func (b *Book) Asks() []Level {
+	return b.asks.levels(0)
+}
+
+// Len returns the number of levels on the side.
+func (b *Book) Len(s Side) int {
+	return len(b.side(s).prices)
+}
+
+// Best returns the best level of the side. It is false if the side is empty.
+func (b *Book) Best(s Side) (Level, bool) {
+	sd := b.side(s)
+	if len(sd.prices) == 0 {
+		return Level{}, false
+	}
+
+	return Level{Price: sd.prices[0], Volume: sd.volumes[sd.prices[0]]}, true
+}
+
+// BestBid returns the highest bid. It is false if there are no bids.
+func (b *Book) BestBid() (Level, bool) {
+	return b.Best(Bid)
+}
+
+// BestAsk returns the lowest ask. It is false if there are no asks.
+func (b *Book) BestAsk() (Level, bool) {
+	return b.Best(Ask)
+}
+
+// Mid returns the mid price. It is false unless both sides have levels.
+func (b *Book) Mid() (float64, bool) {
+	bid, ask, ok := b.top()
+	if !ok {
+		return 0, false
+	}
+
+	return (bid.Price + ask.Price) / 2, true
+}
+
+// Spread returns the difference of the best ask and the best bid.
+// It is false unless both sides have levels.
+func (b *Book) Spread() (float64, bool) {
+	bid, ask, ok := b.top()
+	if !ok {
+		return 0, false
+	}
+
+	return ask.Price - bid.Price, true
+}
+
+// Microprice returns the top of book prices weighted by the volume on the
+// opposite side, which leans towards the side about to be consumed.
+// It is false unless both sides have levels.
+func (b *Book) Microprice() (float64, bool) {
+	bid, ask, ok := b.top()
+	if !ok {
+		return 0, false
+	}
+
+	return (bid.Price*ask.Volume + ask.Price*bid.Volume) / (bid.Volume + ask.Volume), true
+}
+
+// Depth returns the total volume of the top n levels of the side.
+func (b *Book) Depth(s Side, n int) float64 {
+	total := 0.0
+
+	for _, level := range b.side(s).levels(n) {
+		total += level.Volume
+	}
+
+	return total
+}
+
+// CumulativeVolume returns the total volume of the side at prices equal to or
+// better than price, ie the volume available to a taker with that limit.
+func (b *Book) CumulativeVolume(s Side, price float64) float64 {
+	sd := b.side(s)
+	total := 0.0
+
+	for _, p := range sd.prices {
+		if sd.better(price, p) {
+			break
+		}
+
+		total += sd.volumes[p]
+	}
+
+	return total
+}
+
+// Clone returns a deep copy of the book.
+func (b *Book) Clone() *Book {
+	clone := New(b.Symbol, b.depth)
+
+	clone.ApplySnapshot(b.Bids(), b.Asks())
+
+	return clone
+}
+
+func (b *Book) top() (Level, Level, bool) {
+	bid, ok := b.BestBid()
+	if !ok {
+		return Level{}, Level{}, false
+	}
+
+	ask, ok := b.BestAsk()
+	if !ok {
+		return Level{}, Level{}, false
+	}
+
+	return bid, ask, true
+}
+
+func (b *Book) side(s Side) *side {
+	if s == Bid {
+		return b.bids
+	}
+
+	return b.asks
+}
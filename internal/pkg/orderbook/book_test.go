@@ -0,0 +1,87 @@
+package orderbook
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testBook() *Book {
+	book := New("BTC/USD", 3)
+	book.ApplySnapshot(
+		[]Level{{100, 1}, {99, 2}, {101, 0.5}, {98, 4}},
+		[]Level{{103, 2}, {102, 1}},
+	)
+
+	return book
+}
+
+func TestBook_ApplySnapshot(t *testing.T) {
+	book := testBook()
+
+	wantBids := []Level{{101, 0.5}, {100, 1}, {99, 2}}
+	if got := book.Bids(); !reflect.DeepEqual(got, wantBids) {
+		t.Errorf("Bids() = %v, want %v", got, wantBids)
+	}
+
+	wantAsks := []Level{{102, 1}, {103, 2}}
+	if got := book.Asks(); !reflect.DeepEqual(got, wantAsks) {
+		t.Errorf("Asks() = %v, want %v", got, wantAsks)
+	}
+}
+
+func TestBook_ApplyUpdate(t *testing.T) {
+	book := testBook()
+	book.ApplyUpdate(
+		[]Level{{101, 0}, {100, 3}, {100.5, 1}},
+		[]Level{{102, 0}, {104, 1}, {101.5, 2}},
+	)
+
+	wantBids := []Level{{100.5, 1}, {100, 3}, {99, 2}}
+	if got := book.Bids(); !reflect.DeepEqual(got, wantBids) {
+		t.Errorf("Bids() = %v, want %v", got, wantBids)
+	}
+
+	wantAsks := []Level{{101.5, 2}, {103, 2}, {104, 1}}
+	if got := book.Asks(); !reflect.DeepEqual(got, wantAsks) {
+		t.Errorf("Asks() = %v, want %v", got, wantAsks)
+	}
+}
+
+func TestBook_queries(t *testing.T) {
+	book := testBook()
+
+	tests := []struct {
+		name string
+		got  func() (float64, bool)
+		want float64
+	}{
+		{"Mid", book.Mid, 101.5},
+		{"Spread", book.Spread, 1},
+		{"Microprice", book.Microprice, (101*1 + 102*0.5) / 1.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.got()
+			if !ok || got != tt.want {
+				t.Errorf("%s() = %v, %v, want %v", tt.name, got, ok, tt.want)
+			}
+		})
+	}
+
+	if got := book.Depth(Bid, 2); got != 1.5 {
+		t.Errorf("Depth() = %v, want 1.5", got)
+	}
+
+	if got := book.CumulativeVolume(Ask, 102.5); got != 1 {
+		t.Errorf("CumulativeVolume(Ask) = %v, want 1", got)
+	}
+
+	if got := book.CumulativeVolume(Bid, 100); got != 1.5 {
+		t.Errorf("CumulativeVolume(Bid) = %v, want 1.5", got)
+	}
+
+	if _, ok := New("BTC/USD", 0).Mid(); ok {
+		t.Error("Mid() of an empty book is ok")
+	}
+}
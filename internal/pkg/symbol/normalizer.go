@@ -0,0 +1,214 @@
+package symbol
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrUnknownAsset = errors.New("unknown asset")
+	ErrInvalidPair  = errors.New("invalid pair")
+)
+
+// KrakenAliases maps the Kraken asset codes that differ from the canonical
+// ones to the canonical codes. The four letter codes are the legacy names
+// used by the REST API, e.g. in XXBTZUSD.
+var KrakenAliases = map[string]string{
+	"XBT":  "BTC",
+	"XXBT": "BTC",
+	"XDG":  "DOGE",
+	"XXDG": "DOGE",
+	"XETH": "ETH",
+	"XETC": "ETC",
+	"XLTC": "LTC",
+	"XXRP": "XRP",
+	"XXLM": "XLM",
+	"XXMR": "XMR",
+	"XZEC": "ZEC",
+	"XREP": "REP",
+	"XMLN": "MLN",
+	"ZUSD": "USD",
+	"ZEUR": "EUR",
+	"ZGBP": "GBP",
+	"ZCAD": "CAD",
+	"ZJPY": "JPY",
+	"ZAUD": "AUD",
+	"ZCHF": "CHF",
+}
+
+// KrakenRESTNames maps canonical codes to the asset codes of the Kraken REST
+// API where they differ. Assets listed before 2019 keep their legacy four
+// letter codes, later ones use the canonical code.
+var KrakenRESTNames = map[string]string{
+	"BTC":  "XXBT",
+	"DOGE": "XXDG",
+	"ETH":  "XETH",
+	"ETC":  "XETC",
+	"LTC":  "XLTC",
+	"XRP":  "XXRP",
+	"XLM":  "XXLM",
+	"XMR":  "XXMR",
+	"ZEC":  "XZEC",
+	"REP":  "XREP",
+	"MLN":  "XMLN",
+	"USD":  "ZUSD",
+	"EUR":  "ZEUR",
+	"GBP":  "ZGBP",
+	"CAD":  "ZCAD",
+	"JPY":  "ZJPY",
+	"AUD":  "ZAUD",
+	"CHF":  "ZCHF",
+}
+
+var (
+	// Kraken normalizes Kraken asset codes for the websocket v2 API and
+	// accepts any asset. Websocket v2 uses the canonical codes throughout, as
+	// in BTC/USD, so it needs no names.
+	Kraken = NewNormalizer(KrakenAliases, nil)
+
+	// KrakenREST normalizes Kraken asset codes for the REST API and accepts
+	// any asset.
+	KrakenREST = NewNormalizer(KrakenAliases, KrakenRESTNames)
+)
+
+// Normalizer maps between exchange asset codes and canonical ones, in both
+// directions.
+type Normalizer struct {
+	canonical map[string]string
+	native    map[string]string
+
+	// aliased holds the canonical codes that have an exchange alias or name
+	aliased map[string]struct{}
+
+	// assets restricts the canonical codes accepted, empty accepts any
+	assets map[string]struct{}
+}
+
+// NewNormalizer creates a normalizer for the aliases, mapping exchange codes
+// to canonical ones, and the names, mapping canonical codes to the names of
+// one exchange API where they differ, nil if the API uses the canonical
+// codes. If assets are given, codes not resolving to one of them are
+// rejected.
+func NewNormalizer(aliases, names map[string]string, assets ...string) *Normalizer {
+	n := &Normalizer{
+		canonical: make(map[string]string, len(aliases)),
+		native:    make(map[string]string, len(names)),
+		aliased:   make(map[string]struct{}, len(aliases)),
+		assets:    make(map[string]struct{}, len(assets)),
+	}
+
+	for alias, canonical := range aliases {
+		n.canonical[alias] = canonical
+		n.aliased[canonical] = struct{}{}
+	}
+
+	for canonical, native := range names {
+		n.native[canonical] = native
+		n.aliased[canonical] = struct{}{}
+	}
+
+	for _, asset := range assets {
+		n.assets[n.resolve(asset)] = struct{}{}
+	}
+
+	return n
+}
+
+// Canonical returns the canonical code of an exchange asset code.
+func (n *Normalizer) Canonical(asset string) (string, error) {
+	canonical := n.resolve(asset)
+	if canonical == "" {
+		return "", errors.Wrap(ErrUnknownAsset, "empty asset")
+	}
+
+	if len(n.assets) == 0 {
+		return canonical, nil
+	}
+
+	if _, ok := n.assets[canonical]; !ok {
+		return "", errors.Wrap(ErrUnknownAsset, asset)
+	}
+
+	return canonical, nil
+}
+
+// Native returns the name of an asset in the exchange API of the normalizer.
+func (n *Normalizer) Native(asset string) string {
+	canonical := n.resolve(asset)
+
+	if native, ok := n.native[canonical]; ok {
+		return native
+	}
+
+	return canonical
+}
+
+// Pair returns the canonical base and quote of an exchange pair. Pairs are
+// either separated by a slash, as in XBT/USD, or concatenated, as in XBTUSD,
+// XXBTZUSD or SOLEUR. Concatenated pairs are split where both parts are
+// aliases or known assets, otherwise after the longest known quote or the
+// shortest known base.
+func (n *Normalizer) Pair(pair string) (string, string, error) {
+	if base, quote, found := strings.Cut(pair, "/"); found {
+		return n.split(pair, base, quote)
+	}
+
+	for idx := 1; idx < len(pair); idx++ {
+		if n.known(pair[:idx]) && n.known(pair[idx:]) {
+			return n.split(pair, pair[:idx], pair[idx:])
+		}
+	}
+
+	for idx := 1; idx < len(pair); idx++ {
+		if n.known(pair[idx:]) {
+			return n.split(pair, pair[:idx], pair[idx:])
+		}
+	}
+
+	for idx := 1; idx < len(pair); idx++ {
+		if n.known(pair[:idx]) {
+			return n.split(pair, pair[:idx], pair[idx:])
+		}
+	}
+
+	return "", "", errors.Wrap(ErrInvalidPair, pair)
+}
+
+func (n *Normalizer) split(pair, base, quote string) (string, string, error) {
+	base, err := n.Canonical(base)
+	if err != nil {
+		return "", "", errors.Wrap(err, pair)
+	}
+
+	quote, err = n.Canonical(quote)
+	if err != nil {
+		return "", "", errors.Wrap(err, pair)
+	}
+
+	return base, quote, nil
+}
+
+// known reports whether the code is an alias, a canonical code of an alias or
+// one of the accepted assets.
+func (n *Normalizer) known(asset string) bool {
+	canonical := n.resolve(asset)
+
+	if _, ok := n.assets[canonical]; ok {
+		return true
+	}
+
+	_, ok := n.aliased[canonical]
+
+	return ok
+}
+
+func (n *Normalizer) resolve(asset string) string {
+	asset = strings.ToUpper(strings.TrimSpace(asset))
+
+	if canonical, ok := n.canonical[asset]; ok {
+		return canonical
+	}
+
+	return asset
+}
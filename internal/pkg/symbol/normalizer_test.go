@@ -0,0 +1,97 @@
+package symbol
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestNormalizer_Canonical(t *testing.T) {
+	tests := []struct {
+		name       string
+		normalizer *Normalizer
+		asset      string
+		want       string
+		wantErr    error
+	}{
+		{"Alias", Kraken, "XBT", "BTC", nil},
+		{"Legacy REST name", Kraken, "ZUSD", "USD", nil},
+		{"Lower case", Kraken, "xdg", "DOGE", nil},
+		{"Any asset", Kraken, "SOL", "SOL", nil},
+		{"Empty", Kraken, "", "", ErrUnknownAsset},
+		{"Known asset", NewNormalizer(KrakenAliases, nil, "BTC", "USD"), "XXBT", "BTC", nil},
+		{"Unknown asset", NewNormalizer(KrakenAliases, nil, "BTC", "USD"), "SOL", "", ErrUnknownAsset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.normalizer.Canonical(tt.asset)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Canonical() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Canonical() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizer_Native(t *testing.T) {
+	tests := []struct {
+		name       string
+		normalizer *Normalizer
+		asset      string
+		want       string
+	}{
+		{"Websocket", Kraken, "BTC", "BTC"},
+		{"Websocket alias", Kraken, "XBT", "BTC"},
+		{"Websocket legacy name", Kraken, "ZUSD", "USD"},
+		{"REST", KrakenREST, "BTC", "XXBT"},
+		{"REST alias", KrakenREST, "XDG", "XXDG"},
+		{"REST fiat", KrakenREST, "USD", "ZUSD"},
+		{"REST legacy asset", KrakenREST, "ETH", "XETH"},
+		{"REST later asset", KrakenREST, "SOL", "SOL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.normalizer.Native(tt.asset); got != tt.want {
+				t.Errorf("Native() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizer_Pair(t *testing.T) {
+	tests := []struct {
+		pair      string
+		wantBase  string
+		wantQuote string
+		wantErr   error
+	}{
+		{"XBT/USD", "BTC", "USD", nil},
+		{"XXBTZUSD", "BTC", "USD", nil},
+		{"XBTEUR", "BTC", "EUR", nil},
+		{"XDGUSD", "DOGE", "USD", nil},
+		{"SOL/EUR", "SOL", "EUR", nil},
+		{"SOLEUR", "SOL", "EUR", nil},
+		{"USDCUSD", "USDC", "USD", nil},
+		{"XBTUSDT", "BTC", "USDT", nil},
+		{"SOLUSDT", "", "", ErrInvalidPair},
+		{"/USD", "", "", ErrUnknownAsset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pair, func(t *testing.T) {
+			base, quote, err := Kraken.Pair(tt.pair)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Pair() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if base != tt.wantBase || quote != tt.wantQuote {
+				t.Errorf("Pair() = %v, %v, want %v, %v", base, quote, tt.wantBase, tt.wantQuote)
+			}
+		})
+	}
+}